@@ -0,0 +1,330 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// lazyFunc receives its arguments unevaluated, for functions that evaluate
+// an argument once per element.
+type lazyFunc func(env *Env, args []node) (interface{}, error)
+
+var lazyBuiltins = map[string]lazyFunc{
+	"sum":      sum,
+	"count":    count,
+	"min":      minOf,
+	"max":      maxOf,
+	"avg":      avg,
+	"distinct": distinct,
+	"unique":   distinct,
+	"map":      mapList,
+}
+
+// elements evaluates an aggregate's arguments. The first must yield a list
+// (a single value counts as a list of one). An optional second argument is
+// evaluated once per element, with the element as "@" and as the scope for
+// bare field names: sum(line_items, price * quantity). A null first argument
+// yields a nil list. Arithmetic over a projection is evaluated per element of
+// the projected list, so sum(line_items[*].price * quantity) is the same sum.
+func elements(env *Env, args []node) ([]interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	var fn node
+	if len(args) == 2 {
+		fn = args[1]
+	}
+
+	var src interface{}
+	if base, perElement, ok := elementWise(args[0]); ok && fn == nil {
+		// sum(line_items[*].price * quantity) reads as
+		// sum(line_items, price * quantity).
+		src, fn = resolve(env.Fields, base), perElement
+	} else {
+		var err error
+		if src, err = args[0].eval(env); err != nil {
+			return nil, err
+		}
+	}
+
+	items := listOf(src)
+	if fn == nil || src == nil {
+		return items, nil
+	}
+
+	return mapElements(env, items, fn)
+}
+
+// elementWise recognizes arithmetic over one projection, such as
+// line_items[*].price * quantity, and returns the projected list's path and
+// the expression to evaluate per element: price * quantity. Bare field names
+// are read from each element, as in the two-argument form.
+func elementWise(n node) (base []string, perElement node, ok bool) {
+	if _, isArithmetic := n.(*arithmetic); !isArithmetic {
+		return nil, nil, false
+	}
+
+	var rewrite func(n node) node
+	rewrite = func(n node) node {
+		switch v := n.(type) {
+		case *arithmetic:
+			left, right := rewrite(v.left), rewrite(v.right)
+			if left == nil || right == nil {
+				return nil
+			}
+			return &arithmetic{op: v.op, left: left, right: right, pos: v.pos}
+
+		case *fieldRef:
+			star := -1
+			for i, seg := range v.path {
+				if seg == "*" {
+					star = i
+					break
+				}
+			}
+			if star < 0 {
+				return v
+			}
+			rest := v.path[star+1:]
+			// One list per expression, and no nested projection.
+			if base != nil && !samePath(base, v.path[:star]) || containsWildcard(rest) {
+				return nil
+			}
+			base = v.path[:star]
+			if len(rest) == 0 {
+				// prices[*] * 2: the element itself.
+				return &ancestorRef{}
+			}
+			return &fieldRef{path: rest}
+		}
+		return n
+	}
+
+	perElement = rewrite(n)
+	if perElement == nil || base == nil {
+		return nil, nil, false
+	}
+	return base, perElement, true
+}
+
+func samePath(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// listOf treats a single value as a list of one and null as an empty list.
+func listOf(val interface{}) []interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		return v
+	}
+	return []interface{}{val}
+}
+
+// mapElements evaluates fn once per element, with the element as "@" and as
+// the scope for bare field names.
+func mapElements(env *Env, items []interface{}, fn node) ([]interface{}, error) {
+	mapped := make([]interface{}, len(items))
+	for i, item := range items {
+		val, err := fn.eval(&Env{
+			Stack:  append(env.Stack[:len(env.Stack):len(env.Stack)], item),
+			Fields: item,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		mapped[i] = val
+	}
+	return mapped, nil
+}
+
+// numbers converts aggregate inputs, skipping nulls. Numeric strings are
+// accepted; anything else is an error naming the offending element.
+func numbers(items []interface{}) ([]float64, error) {
+	out := make([]float64, 0, len(items))
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		f, ok := ToNumber(item)
+		if !ok {
+			return nil, fmt.Errorf("non-numeric value %s at element %d", quote(item), i)
+		}
+		out = append(out, f)
+	}
+	return out, nil
+}
+
+// sum adds the elements. A missing list sums to null, like avg, min and max,
+// but an empty one sums to 0.
+func sum(env *Env, args []node) (interface{}, error) {
+	items, err := elements(env, args)
+	if err != nil || items == nil {
+		return nil, err
+	}
+	nums, err := numbers(items)
+	if err != nil {
+		return nil, err
+	}
+
+	return decimalSum(nums)
+}
+
+// count counts elements; with a second argument, only those for which it is
+// truthy: count(users, active).
+func count(env *Env, args []node) (interface{}, error) {
+	items, err := elements(env, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 1 {
+		return float64(len(items)), nil
+	}
+
+	n := 0
+	for _, item := range items {
+		if Truthy(item) {
+			n++
+		}
+	}
+	return float64(n), nil
+}
+
+func avg(env *Env, args []node) (interface{}, error) {
+	items, err := elements(env, args)
+	if err != nil {
+		return nil, err
+	}
+	nums, err := numbers(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, nil
+	}
+
+	total, err := decimalSum(nums)
+	if err != nil {
+		return nil, err
+	}
+	return calc("/", total, float64(len(nums)))
+}
+
+func minOf(env *Env, args []node) (interface{}, error) {
+	return extreme(env, args, func(a, b float64) bool { return a < b })
+}
+
+func maxOf(env *Env, args []node) (interface{}, error) {
+	return extreme(env, args, func(a, b float64) bool { return a > b })
+}
+
+// extreme serves both min(list, expr) and min(a, b, c). The variadic form
+// applies only when every argument is a number, a numeric string or null;
+// anything else is the list form, where a single object is a list of one.
+func extreme(env *Env, args []node, better func(a, b float64) bool) (interface{}, error) {
+	var items []interface{}
+	if len(args) >= 2 {
+		first, err := args[0].eval(env)
+		if err != nil {
+			return nil, err
+		}
+		// A null first argument keeps the list form, so a missing list
+		// yields null rather than comparing the per-element expression.
+		if _, ok := ToNumber(first); ok {
+			candidates := []interface{}{first}
+			for _, arg := range args[1:] {
+				// A failing argument is left for the list form to report,
+				// since it may be meant per element.
+				val, err := arg.eval(env)
+				if _, ok := ToNumber(val); err != nil || !ok && val != nil {
+					candidates = nil
+					break
+				}
+				candidates = append(candidates, val)
+			}
+			items = candidates
+		}
+	}
+
+	if items == nil {
+		var err error
+		if items, err = elements(env, args); err != nil {
+			return nil, err
+		}
+	}
+	nums, err := numbers(items)
+	if err != nil {
+		return nil, err
+	}
+	if len(nums) == 0 {
+		return nil, nil
+	}
+
+	best := nums[0]
+	for _, n := range nums[1:] {
+		if better(n, best) {
+			best = n
+		}
+	}
+	return best, nil
+}
+
+// distinct drops nulls and repeated elements, keeping the first of each. An
+// optional second argument is evaluated per element as the key to compare, so
+// distinct(addresses, city) keeps one address per city. Elements are compared
+// by value, so equal objects count as repeats. unique is another name for it.
+func distinct(env *Env, args []node) (interface{}, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("expected 1 or 2 arguments, got %d", len(args))
+	}
+
+	src, err := args[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, nil
+	}
+	items := listOf(src)
+
+	keys := items
+	if len(args) == 2 {
+		if keys, err = mapElements(env, items, args[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[string]bool)
+	out := make([]interface{}, 0, len(items))
+	for i, item := range items {
+		if item == nil {
+			continue
+		}
+		key := identity(keys[i])
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, item)
+	}
+	return out, nil
+}
+
+// identity renders a value so equal JSON values map to the same string.
+func identity(val interface{}) string {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return fmt.Sprintf("%T:%v", val, val)
+	}
+	return string(b)
+}
@@ -0,0 +1,167 @@
+package expr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Array functions treat a single value as a list of one, like the aggregates,
+// and return null for a null list.
+
+// first returns the first element, or null for an empty list.
+func first(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	items := listOf(args[0])
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items[0], nil
+}
+
+// last returns the last element, or null for an empty list.
+func last(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	items := listOf(args[0])
+	if len(items) == 0 {
+		return nil, nil
+	}
+	return items[len(items)-1], nil
+}
+
+// slice returns the elements from start up to end (exclusive, default the
+// end of the list). Negative positions count from the end: slice(lines, -2)
+// is the last two.
+func slice(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	items := listOf(args[0])
+	start, err := intArg(args[1], "start")
+	if err != nil {
+		return nil, err
+	}
+	end := len(items)
+	if len(args) == 3 {
+		if end, err = intArg(args[2], "end"); err != nil {
+			return nil, err
+		}
+	}
+
+	start, end = clampIndex(start, len(items)), clampIndex(end, len(items))
+	out := make([]interface{}, 0, len(items))
+	if start < end {
+		out = append(out, items[start:end]...)
+	}
+	return out, nil
+}
+
+func reverse(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	items := listOf(args[0])
+	out := make([]interface{}, len(items))
+	for i, item := range items {
+		out[len(items)-1-i] = item
+	}
+	return out, nil
+}
+
+// flattenArray splices nested lists into one list, all the way down or to an
+// optional depth: flattenArray(name[*].given, 1).
+func flattenArray(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	depth := -1
+	if len(args) == 2 {
+		var err error
+		if depth, err = intArg(args[1], "depth"); err != nil {
+			return nil, err
+		}
+	}
+	return flattenList(listOf(args[0]), depth), nil
+}
+
+func flattenList(items []interface{}, depth int) []interface{} {
+	out := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if nested, ok := item.([]interface{}); ok && depth != 0 {
+			out = append(out, flattenList(nested, depth-1)...)
+			continue
+		}
+		out = append(out, item)
+	}
+	return out
+}
+
+// indexOf returns the position of the first element equal to a value, or of
+// a substring within text, and -1 when there is none.
+func indexOf(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	return float64(position(args[0], args[1])), nil
+}
+
+// contains reports whether a list holds a value or text holds a substring.
+func contains(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	return position(args[0], args[1]) >= 0, nil
+}
+
+func position(in, val interface{}) int {
+	switch v := in.(type) {
+	case nil:
+		return -1
+	case string:
+		idx := strings.Index(v, toText(val))
+		if idx < 0 {
+			return -1
+		}
+		// Count characters, like substring does.
+		return len([]rune(v[:idx]))
+	}
+
+	for i, item := range listOf(in) {
+		if equal(item, val) {
+			return i
+		}
+	}
+	return -1
+}
+
+// mapList evaluates an expression once per element and returns the results
+// in order, nulls included: map(telecom, concat(system, ':', value)).
+func mapList(env *Env, args []node) (interface{}, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("expected 2 arguments, got %d", len(args))
+	}
+
+	src, err := args[0].eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, nil
+	}
+	return mapElements(env, listOf(src), args[1])
+}
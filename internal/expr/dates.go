@@ -0,0 +1,512 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	// Zone names resolve without a system tz database.
+	_ "time/tzdata"
+)
+
+// Dates travel between functions as ISO 8601 text ("2023-11-01T08:00:00Z"),
+// so results can be written to JSON and read back by the next call. Inputs
+// are recognized as ISO 8601 (with or without an offset, or a bare date),
+// RFC 1123 or epoch numbers: seconds, or milliseconds for values too large to
+// be seconds. Zoneless inputs are read as UTC unless a zone is given.
+
+// epochMillisThreshold separates epoch seconds from milliseconds: as seconds
+// it is in the year 5138, as milliseconds in 1973.
+const epochMillisThreshold = 1e11
+
+// Named formats accepted wherever a pattern is.
+const (
+	formatISO         = "iso"
+	formatRFC1123     = "rfc1123"
+	formatEpoch       = "epochSeconds"
+	formatEpochMillis = "epochMillis"
+)
+
+// autoLayouts are tried in order when no format is given.
+var autoLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// parseDate reads a date, optionally with a format and the zone zoneless
+// input is in: parseDate(dob, 'MM/dd/yyyy'), parseDate(ts, 'epochMillis').
+func parseDate(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	loc := time.UTC
+	if len(args) == 3 {
+		var err error
+		if loc, err = zoneArg(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	format := ""
+	if len(args) >= 2 && args[1] != nil {
+		format = toText(args[1])
+	}
+
+	t, err := readTime(args[0], format, loc)
+	if err != nil {
+		return nil, err
+	}
+	return isoText(t), nil
+}
+
+// formatDate writes a date with a pattern or named format, after converting
+// it to zone when one is given: formatDate(ts, 'dd MMM yyyy', 'Europe/Paris').
+func formatDate(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	t, err := readTime(args[0], "", time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 3 {
+		loc, err := zoneArg(args[2])
+		if err != nil {
+			return nil, err
+		}
+		t = t.In(loc)
+	}
+
+	switch format := toText(args[1]); format {
+	case formatISO:
+		return isoText(t), nil
+	case formatRFC1123:
+		return t.Format(time.RFC1123), nil
+	case formatEpoch:
+		return float64(t.Unix()), nil
+	case formatEpochMillis:
+		return float64(t.UnixMilli()), nil
+	default:
+		pieces, err := javaLayout(format)
+		if err != nil {
+			return nil, err
+		}
+		return formatPieces(t, pieces), nil
+	}
+}
+
+// convertZone expresses a date in another zone; the instant is unchanged.
+func convertZone(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	t, err := readTime(args[0], "", time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := zoneArg(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return isoText(t.In(loc)), nil
+}
+
+// addDuration shifts a date by an ISO 8601 duration ("P1DT2H", "-P2W") or a
+// Go duration ("90m", "-1h30m"). Years, months, weeks and days follow the
+// calendar in the date's own zone.
+func addDuration(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	t, err := readTime(args[0], "", time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	t, err = shiftTime(t, toText(args[1]))
+	if err != nil {
+		return nil, err
+	}
+	return isoText(t), nil
+}
+
+// dateDiff returns end minus start in a unit: "millis", "seconds" (the
+// default), "minutes", "hours", "days" or "weeks". Partial units are kept as
+// a fraction.
+func dateDiff(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil || args[1] == nil {
+		return nil, nil
+	}
+
+	start, err := readTime(args[0], "", time.UTC)
+	if err != nil {
+		return nil, err
+	}
+	end, err := readTime(args[1], "", time.UTC)
+	if err != nil {
+		return nil, err
+	}
+
+	unit := "seconds"
+	if len(args) == 3 {
+		unit = toText(args[2])
+	}
+	size, ok := durationUnits[unit]
+	if !ok {
+		return nil, fmt.Errorf("unknown unit %q", unit)
+	}
+	return float64(end.Sub(start)) / float64(size), nil
+}
+
+var durationUnits = map[string]time.Duration{
+	"millis":  time.Millisecond,
+	"seconds": time.Second,
+	"minutes": time.Minute,
+	"hours":   time.Hour,
+	"days":    24 * time.Hour,
+	"weeks":   7 * 24 * time.Hour,
+}
+
+// readTime parses a date value. An empty format recognizes the inputs listed
+// at the top of this file.
+func readTime(val interface{}, format string, loc *time.Location) (time.Time, error) {
+	if f, ok := numberOf(val); ok {
+		switch format {
+		case "":
+			if math.Abs(f) >= epochMillisThreshold {
+				return time.UnixMilli(int64(f)).UTC(), nil
+			}
+			return epochSeconds(f), nil
+		case formatEpoch:
+			return epochSeconds(f), nil
+		case formatEpochMillis:
+			return time.UnixMilli(int64(f)).UTC(), nil
+		}
+		val = toText(val)
+	}
+
+	text, ok := val.(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("cannot read %s as a date", quote(val))
+	}
+	text = strings.TrimSpace(text)
+
+	var layouts []string
+	switch format {
+	case "":
+		layouts = autoLayouts
+	case formatISO:
+		layouts = autoLayouts[:5]
+	case formatRFC1123:
+		layouts = []string{time.RFC1123Z, time.RFC1123}
+	case formatEpoch, formatEpochMillis:
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("cannot read %q as %s", text, format)
+		}
+		return readTime(f, format, loc)
+	default:
+		pieces, err := javaLayout(format)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if t, err := parsePieces(text, pieces, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	for _, layout := range layouts {
+		t, err := time.ParseInLocation(layout, text, loc)
+		if err != nil {
+			continue
+		}
+		if layout == time.RFC1123 {
+			return rfc1123Zone(t, loc)
+		}
+		return t, nil
+	}
+	if format == "" {
+		return time.Time{}, fmt.Errorf("cannot read %q as a date", text)
+	}
+	return time.Time{}, fmt.Errorf("cannot read %q as a date in format %q", text, format)
+}
+
+func epochSeconds(f float64) time.Time {
+	sec, frac := math.Modf(f)
+	return time.Unix(int64(sec), int64(math.Round(frac*1e9))).UTC()
+}
+
+func isoText(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func zoneArg(val interface{}) (*time.Location, error) {
+	name := toText(val)
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", name)
+	}
+	return loc, nil
+}
+
+// javaLayouts maps runs of pattern letters, as in Java's DateTimeFormatter,
+// to Go layout elements.
+var javaLayouts = map[string]string{
+	"yyyy": "2006", "yy": "06", "y": "2006",
+	"MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+	"dd": "02", "d": "2",
+	"EEEE": "Monday", "EEE": "Mon", "E": "Mon",
+	"HH": "15", "H": "15",
+	"hh": "03", "h": "3",
+	"mm": "04", "m": "4",
+	"ss": "05", "s": "5",
+	"S": ".0", "SS": ".00", "SSS": ".000", "SSSSSS": ".000000", "SSSSSSSSS": ".000000000",
+	"a":   "PM",
+	"XXX": "Z07:00", "XX": "Z0700", "X": "Z07",
+	"xxx": "-07:00", "xx": "-0700", "Z": "-0700",
+	"z": "MST",
+}
+
+// rfc822Zones are the North American zone abbreviations RFC 822 defines.
+var rfc822Zones = map[string]int{
+	"EST": -5, "EDT": -4,
+	"CST": -6, "CDT": -5,
+	"MST": -7, "MDT": -6,
+	"PST": -8, "PDT": -7,
+}
+
+// rfc1123Zone applies the offset of an RFC 1123 zone abbreviation. Go reads
+// abbreviations that loc does not know at offset 0, so the RFC 822 zones are
+// mapped here and any other unknown abbreviation is an error.
+func rfc1123Zone(t time.Time, loc *time.Location) (time.Time, error) {
+	name, offset := t.Zone()
+	if offset != 0 || t.Location() == loc || name == "UTC" || name == "GMT" || name == "UT" {
+		return t, nil
+	}
+	hours, ok := rfc822Zones[name]
+	if !ok {
+		return time.Time{}, fmt.Errorf("unknown time zone abbreviation %q", name)
+	}
+	zone := time.FixedZone(name, hours*60*60)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), zone), nil
+}
+
+// datePiece is one part of a converted pattern: a Go layout, or literal text
+// that must not be read as layout elements.
+type datePiece struct {
+	text    string
+	literal bool
+}
+
+// javaLayout converts a pattern such as "yyyy-MM-dd'T'HH:mm:ss.SSSXXX" into
+// Go layout pieces. Text in single quotes is literal and two single quotes in
+// a row write one. Digits and "_" are literal too, since Go would read them
+// as layout elements; other punctuation stays in the layout.
+func javaLayout(pattern string) ([]datePiece, error) {
+	var pieces []datePiece
+	add := func(text string, literal bool) {
+		if n := len(pieces); n > 0 && pieces[n-1].literal == literal {
+			pieces[n-1].text += text
+			return
+		}
+		pieces = append(pieces, datePiece{text: text, literal: literal})
+	}
+
+	for i := 0; i < len(pattern); {
+		c := pattern[i]
+
+		if c == '\'' {
+			end := strings.IndexByte(pattern[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quote in date pattern %q", pattern)
+			}
+			if end == 0 {
+				add("'", true)
+			} else {
+				add(pattern[i+1:i+1+end], true)
+			}
+			i += end + 2
+			continue
+		}
+
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			add(string(c), c == '_' || c >= '0' && c <= '9')
+			i++
+			continue
+		}
+
+		j := i
+		for j < len(pattern) && pattern[j] == c {
+			j++
+		}
+		layout, ok := javaLayouts[pattern[i:j]]
+		if !ok {
+			return nil, fmt.Errorf("unsupported date pattern %q in %q", pattern[i:j], pattern)
+		}
+		// Go writes fractional seconds only as part of ".000" or ",000",
+		// so the pattern must put a separator in front of them.
+		if c == 'S' {
+			n := len(pieces)
+			if n == 0 || pieces[n-1].literal || !strings.HasSuffix(pieces[n-1].text, ".") && !strings.HasSuffix(pieces[n-1].text, ",") {
+				return nil, fmt.Errorf("fractional seconds %q in %q must follow \".\" or \",\"", pattern[i:j], pattern)
+			}
+			layout = layout[1:]
+		}
+		add(layout, false)
+		i = j
+	}
+	return pieces, nil
+}
+
+// formatPieces writes t with the layout pieces and splices in the literals.
+func formatPieces(t time.Time, pieces []datePiece) string {
+	var sb strings.Builder
+	for _, p := range pieces {
+		if p.literal {
+			sb.WriteString(p.text)
+		} else {
+			sb.WriteString(t.Format(p.text))
+		}
+	}
+	return sb.String()
+}
+
+// literalMark stands in for literal text while parsing. It is a private-use
+// character, so Go compares it as plain text on both sides.
+const literalMark = "\uE000"
+
+// parsePieces reads text with layout pieces. Each literal is found in the
+// text after the previous one and replaced, together with its place in the
+// layout, by literalMark.
+func parsePieces(text string, pieces []datePiece, loc *time.Location) (time.Time, error) {
+	var layout, value strings.Builder
+	rest := text
+	for _, p := range pieces {
+		if !p.literal {
+			layout.WriteString(p.text)
+			continue
+		}
+		idx := strings.Index(rest, p.text)
+		if idx < 0 {
+			return time.Time{}, fmt.Errorf("missing %q", p.text)
+		}
+		value.WriteString(rest[:idx])
+		value.WriteString(literalMark)
+		rest = rest[idx+len(p.text):]
+		layout.WriteString(literalMark)
+	}
+	value.WriteString(rest)
+	return time.ParseInLocation(layout.String(), value.String(), loc)
+}
+
+// shiftTime adds an ISO 8601 or Go duration to t.
+func shiftTime(t time.Time, duration string) (time.Time, error) {
+	text := strings.TrimSpace(duration)
+	sign := 1
+	if strings.HasPrefix(text, "-") {
+		sign, text = -1, text[1:]
+	}
+
+	if !strings.HasPrefix(strings.ToUpper(text), "P") {
+		d, err := time.ParseDuration(text)
+		if err != nil {
+			return t, fmt.Errorf("invalid duration %q", duration)
+		}
+		return t.Add(time.Duration(sign) * d), nil
+	}
+
+	// ISO 8601: PnYnMnWnDTnHnMnS.
+	var years, months, days int
+	var clock time.Duration
+	inTime := false
+	num := ""
+	for _, r := range strings.ToUpper(text[1:]) {
+		switch {
+		case r >= '0' && r <= '9' || r == '.':
+			num += string(r)
+			continue
+		case r == 'T':
+			inTime = true
+			continue
+		}
+
+		if num == "" {
+			return t, fmt.Errorf("invalid duration %q", duration)
+		}
+		f, err := strconv.ParseFloat(num, 64)
+		if err != nil {
+			return t, fmt.Errorf("invalid duration %q", duration)
+		}
+		n := int(f)
+		// Calendar units have no exact fraction; only the time part may
+		// carry one (PT1.5H).
+		if !inTime && float64(n) != f {
+			return t, fmt.Errorf("invalid duration %q: only hours, minutes and seconds may have a fraction", duration)
+		}
+		num = ""
+
+		switch {
+		case !inTime && r == 'Y':
+			years += n
+		case !inTime && r == 'M':
+			months += n
+		case !inTime && r == 'W':
+			days += 7 * n
+		case !inTime && r == 'D':
+			days += n
+		case inTime && r == 'H':
+			clock += time.Duration(f * float64(time.Hour))
+		case inTime && r == 'M':
+			clock += time.Duration(f * float64(time.Minute))
+		case inTime && r == 'S':
+			clock += time.Duration(f * float64(time.Second))
+		default:
+			return t, fmt.Errorf("invalid duration %q", duration)
+		}
+	}
+	if num != "" {
+		return t, fmt.Errorf("invalid duration %q", duration)
+	}
+
+	t = addMonths(t, sign*(12*years+months))
+	return t.AddDate(0, 0, sign*days).Add(time.Duration(sign) * clock), nil
+}
+
+// addMonths moves t by whole months, keeping the day of the month but
+// clamping it to the target month's last day, as Java's Period does:
+// January 31 plus one month is February 29 in 2024, not March 2.
+func addMonths(t time.Time, months int) time.Time {
+	if months == 0 {
+		return t
+	}
+	year, month, day := t.Date()
+	// Day 0 of the month after the target is the target's last day.
+	if last := time.Date(year, month+time.Month(months)+1, 0, 0, 0, 0, 0, t.Location()).Day(); day > last {
+		day = last
+	}
+	return time.Date(year, month+time.Month(months), day, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+}
@@ -0,0 +1,164 @@
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Env supplies the data an expression is evaluated against.
+type Env struct {
+	// Stack holds the values visible to @ references, innermost last:
+	// "@" and "@(0)" read the last entry, "@(1)" the one before it, and so on.
+	Stack []interface{}
+
+	// Fields is the value bare field references are resolved against.
+	Fields interface{}
+}
+
+// Eval evaluates the expression.
+func (x *Expr) Eval(env *Env) (interface{}, error) {
+	if env == nil {
+		env = &Env{}
+	}
+	return x.root.eval(env)
+}
+
+type node interface {
+	eval(env *Env) (interface{}, error)
+}
+
+type literal struct {
+	val interface{}
+}
+
+func (n *literal) eval(*Env) (interface{}, error) {
+	return n.val, nil
+}
+
+type fieldRef struct {
+	path []string
+}
+
+func (n *fieldRef) eval(env *Env) (interface{}, error) {
+	return resolve(env.Fields, n.path), nil
+}
+
+type ancestorRef struct {
+	level int
+	path  []string
+}
+
+func (n *ancestorRef) eval(env *Env) (interface{}, error) {
+	idx := len(env.Stack) - 1 - n.level
+	if idx < 0 {
+		return nil, nil
+	}
+	return resolve(env.Stack[idx], n.path), nil
+}
+
+type call struct {
+	name string
+	fn   Func
+	lazy lazyFunc
+	args []node
+	pos  int
+}
+
+func (n *call) eval(env *Env) (interface{}, error) {
+	if n.lazy != nil {
+		res, err := n.lazy(env, n.args)
+		if err != nil {
+			return nil, fmt.Errorf("%s at position %d: %w", n.name, n.pos, err)
+		}
+		return res, nil
+	}
+
+	args := make([]interface{}, len(n.args))
+	for i, arg := range n.args {
+		val, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = val
+	}
+
+	res, err := n.fn(args)
+	if err != nil {
+		return nil, fmt.Errorf("%s at position %d: %w", n.name, n.pos, err)
+	}
+	return res, nil
+}
+
+// resolve walks path through maps and arrays, returning nil when it is
+// missing. A "*" segment maps the rest of the path over every element or
+// value and returns the non-null results as a list, or nil when there is
+// nothing to project over.
+func resolve(val interface{}, path []string) interface{} {
+	current := val
+	for i, seg := range path {
+		if seg == "*" {
+			if list := project(current, path[i+1:]); list != nil {
+				return list
+			}
+			return nil
+		}
+
+		switch c := current.(type) {
+		case map[string]interface{}:
+			current = c[seg]
+		case []interface{}:
+			idx, err := strconv.Atoi(seg)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return nil
+			}
+			current = c[idx]
+		default:
+			return nil
+		}
+	}
+	return current
+}
+
+func project(val interface{}, rest []string) []interface{} {
+	var children []interface{}
+	switch c := val.(type) {
+	case []interface{}:
+		children = c
+	case map[string]interface{}:
+		keys := make([]string, 0, len(c))
+		for k := range c {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			children = append(children, c[k])
+		}
+	default:
+		return nil
+	}
+
+	out := make([]interface{}, 0, len(children))
+	for _, child := range children {
+		res := resolve(child, rest)
+		if res == nil {
+			continue
+		}
+		// Nested projections flatten into one list.
+		if nested, ok := res.([]interface{}); ok && containsWildcard(rest) {
+			out = append(out, nested...)
+			continue
+		}
+		out = append(out, res)
+	}
+	return out
+}
+
+func containsWildcard(path []string) bool {
+	for _, seg := range path {
+		if seg == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,150 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Func is a built-in function. Arguments arrive already evaluated.
+type Func func(args []interface{}) (interface{}, error)
+
+var builtins = map[string]Func{
+	"concat": concat,
+	"exists": exists,
+	"lookup": lookup,
+
+	// Strings.
+	"upper":        upper,
+	"lower":        lower,
+	"titleCase":    titleCase,
+	"trim":         trim,
+	"substring":    substring,
+	"split":        split,
+	"join":         join,
+	"replace":      replace,
+	"padLeft":      padLeft,
+	"padRight":     padRight,
+	"startsWith":   startsWith,
+	"endsWith":     endsWith,
+	"length":       length,
+	"regexExtract": regexExtract,
+	"regexReplace": regexReplace,
+
+	// Numbers.
+	"add":      fold("+", 2),
+	"subtract": fold("-", 2),
+	"multiply": fold("*", 2),
+	"divide":   fold("/", 2),
+	"mod":      fold("%", 2),
+	"round":    round,
+	"floor":    floor,
+	"ceil":     ceil,
+	"abs":      absolute,
+	"toNumber": toNumber,
+
+	// Dates.
+	"parseDate":   parseDate,
+	"formatDate":  formatDate,
+	"convertZone": convertZone,
+	"addDuration": addDuration,
+	"dateDiff":    dateDiff,
+
+	// Arrays.
+	"first":        first,
+	"last":         last,
+	"slice":        slice,
+	"reverse":      reverse,
+	"flattenArray": flattenArray,
+	"indexOf":      indexOf,
+	"contains":     contains,
+}
+
+// checkArgs validates the number of arguments a function received.
+func checkArgs(args []interface{}, min, max int) error {
+	if len(args) >= min && len(args) <= max {
+		return nil
+	}
+	switch {
+	case min == max && min == 1:
+		return fmt.Errorf("expected 1 argument, got %d", len(args))
+	case min == max:
+		return fmt.Errorf("expected %d arguments, got %d", min, len(args))
+	case max == min+1:
+		return fmt.Errorf("expected %d or %d arguments, got %d", min, max, len(args))
+	}
+	return fmt.Errorf("expected %d to %d arguments, got %d", min, max, len(args))
+}
+
+// intArg reads a whole-number argument such as a position or width.
+func intArg(val interface{}, name string) (int, error) {
+	f, ok := ToNumber(val)
+	if !ok || f != math.Trunc(f) {
+		return 0, fmt.Errorf("%s must be a whole number, got %s", name, quote(val))
+	}
+	return int(f), nil
+}
+
+// concat joins its arguments as text. Arrays are joined with spaces and
+// nulls are skipped.
+func concat(args []interface{}) (interface{}, error) {
+	var sb strings.Builder
+	for _, arg := range args {
+		sb.WriteString(toText(arg))
+	}
+	return sb.String(), nil
+}
+
+// toText renders a value the way concat does. Numbers are written in full,
+// never in exponent form, so 12345678 stays "12345678".
+func toText(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, toText(item))
+		}
+		return strings.Join(parts, " ")
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// exists reports whether its argument is present and not null.
+func exists(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	return args[0] != nil, nil
+}
+
+// lookup maps a value through key/result pairs:
+// lookup(type, 'A', 'TypeA', 'B', 'TypeB'). Keys match by value or by text,
+// so 'true' matches true. A trailing unpaired argument is the fallback;
+// without one an unmatched value is returned as it is.
+func lookup(args []interface{}) (interface{}, error) {
+	if len(args) < 3 {
+		return nil, fmt.Errorf("expected a value and at least one key/result pair, got %d arguments", len(args))
+	}
+
+	val, rest := args[0], args[1:]
+	for len(rest) >= 2 {
+		key := rest[0]
+		if equal(val, key) || (val != nil && key != nil && toText(val) == toText(key)) {
+			return rest[1], nil
+		}
+		rest = rest[2:]
+	}
+	if len(rest) == 1 {
+		return rest[0], nil
+	}
+	return val, nil
+}
@@ -0,0 +1,210 @@
+package expr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokRef // "@" or "@(N,path)"
+	tokLParen
+	tokRParen
+	tokComma
+	tokDot
+	tokLBracket
+	tokRBracket
+	tokOp // operators such as "==", "&&" or "!"
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// lex splits src into tokens.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	i := 0
+
+	for i < len(src) {
+		c := src[i]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && isIdentPart(src[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: src[start:i], pos: start})
+
+		case isDigit(c):
+			start := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			// Fraction only when a digit follows, so "items.0.name" stays a
+			// path, and never for a path segment, so "a.0.1" is two indices.
+			afterDot := len(tokens) > 0 && tokens[len(tokens)-1].kind == tokDot
+			if !afterDot && i+1 < len(src) && src[i] == '.' && isDigit(src[i+1]) {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[start:i], pos: start})
+
+		case c == '\'' || c == '"':
+			start := i
+			text, next, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{kind: tokString, text: text, pos: start})
+			i = next
+
+		case c == '@':
+			// The reference path is raw text so keys need no quoting: @(1,first-name).
+			start := i
+			i++
+			if i < len(src) && src[i] == '(' {
+				end := strings.IndexByte(src[i:], ')')
+				if end < 0 {
+					return nil, &SyntaxError{Pos: start, Msg: "unterminated @( reference"}
+				}
+				tokens = append(tokens, token{kind: tokRef, text: src[i+1 : i+end], pos: start})
+				i += end + 1
+			} else {
+				tokens = append(tokens, token{kind: tokRef, pos: start})
+			}
+
+		case strings.ContainsRune("=!<>&|~+-*/%", rune(c)):
+			op := ""
+			if i+1 < len(src) {
+				if two := src[i : i+2]; operators[two] {
+					op = two
+				}
+			}
+			if op == "" && operators[string(c)] {
+				op = string(c)
+			}
+			if op == "" {
+				return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: op, pos: i})
+			i += len(op)
+
+		default:
+			kind, ok := punctuation[c]
+			if !ok {
+				return nil, &SyntaxError{Pos: i, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, token{kind: kind, text: string(c), pos: i})
+			i++
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(src)})
+	return tokens, nil
+}
+
+// lexString reads the string literal opening at src[start] and returns its
+// text and the index after the closing quote. A backslash escapes the quote
+// characters and itself, and spells \n, \t, \r and \uXXXX; any other
+// backslash is kept.
+func lexString(src string, start int) (string, int, error) {
+	quote := src[start]
+	var sb strings.Builder
+
+	for i := start + 1; i < len(src); i++ {
+		c := src[i]
+		if c == quote {
+			return sb.String(), i + 1, nil
+		}
+		if c != '\\' {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i >= len(src) {
+			break
+		}
+		switch src[i] {
+		case '\\', '\'', '"':
+			sb.WriteByte(src[i])
+		case 'n':
+			sb.WriteByte('\n')
+		case 't':
+			sb.WriteByte('\t')
+		case 'r':
+			sb.WriteByte('\r')
+		case 'u':
+			if i+4 >= len(src) {
+				return "", 0, &SyntaxError{Pos: i - 1, Msg: "incomplete \\u escape"}
+			}
+			r, err := strconv.ParseUint(src[i+1:i+5], 16, 32)
+			if err != nil {
+				return "", 0, &SyntaxError{Pos: i - 1, Msg: fmt.Sprintf("invalid \\u escape %q", src[i-1:i+5])}
+			}
+			sb.WriteRune(rune(r))
+			i += 4
+		default:
+			// Kept as written so regular expressions such as '\.com$'
+			// need no doubling.
+			sb.WriteByte('\\')
+			sb.WriteByte(src[i])
+		}
+	}
+
+	return "", 0, &SyntaxError{Pos: start, Msg: "unterminated string"}
+}
+
+var punctuation = map[byte]tokenKind{
+	'(': tokLParen,
+	')': tokRParen,
+	',': tokComma,
+	'.': tokDot,
+	'[': tokLBracket,
+	']': tokRBracket,
+}
+
+var operators = map[string]bool{
+	"==": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"=~": true,
+	"&&": true,
+	"||": true,
+	"!":  true,
+	"+":  true,
+	"-":  true,
+	"*":  true,
+	"/":  true,
+	"%":  true,
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
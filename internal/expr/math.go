@@ -0,0 +1,227 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Arithmetic runs on exact decimals: each operand is read as the shortest
+// decimal that round-trips its float64, so 0.1 + 0.2 is 0.3 and summing cents
+// does not drift. Results go back to float64, which JSON writes without a
+// fraction when the value is whole.
+
+var errDivisionByZero = errors.New("division by zero")
+
+// errNotFinite reports a NaN or infinite operand or result, which JSON cannot
+// hold.
+var errNotFinite = errors.New("result is not a finite number")
+
+// decimal converts a float64 to the decimal it was written as.
+func decimal(f float64) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(f, 'g', -1, 64))
+	if !ok {
+		// NaN and infinities have no decimal form.
+		return nil, errNotFinite
+	}
+	return r, nil
+}
+
+// fromDecimal converts back, failing when the result overflows a float64.
+func fromDecimal(r *big.Rat) (float64, error) {
+	f, _ := r.Float64()
+	if math.IsInf(f, 0) {
+		return 0, errNotFinite
+	}
+	return f, nil
+}
+
+// calc applies a binary arithmetic operator.
+func calc(op string, a, b float64) (float64, error) {
+	x, err := decimal(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := decimal(b)
+	if err != nil {
+		return 0, err
+	}
+
+	switch op {
+	case "+":
+		return fromDecimal(x.Add(x, y))
+	case "-":
+		return fromDecimal(x.Sub(x, y))
+	case "*":
+		return fromDecimal(x.Mul(x, y))
+	}
+
+	if y.Sign() == 0 {
+		return 0, errDivisionByZero
+	}
+	q := new(big.Rat).Quo(x, y)
+	if op == "/" {
+		return fromDecimal(q)
+	}
+	// "%" keeps the sign of the dividend, like math.Mod.
+	whole := new(big.Int).Quo(q.Num(), q.Denom())
+	return fromDecimal(x.Sub(x, y.Mul(y, new(big.Rat).SetInt(whole))))
+}
+
+// decimalSum adds numbers without accumulating float error.
+func decimalSum(nums []float64) (float64, error) {
+	total := new(big.Rat)
+	for _, n := range nums {
+		d, err := decimal(n)
+		if err != nil {
+			return 0, err
+		}
+		total.Add(total, d)
+	}
+	return fromDecimal(total)
+}
+
+// operands converts function arguments to numbers. ok is false when any of
+// them is null, which makes the result null like it does for operators.
+func operands(args []interface{}) (nums []float64, ok bool, err error) {
+	nums = make([]float64, len(args))
+	for i, arg := range args {
+		if arg == nil {
+			return nil, false, nil
+		}
+		f, isNum := ToNumber(arg)
+		if !isNum {
+			return nil, false, fmt.Errorf("non-numeric value %s", quote(arg))
+		}
+		nums[i] = f
+	}
+	return nums, true, nil
+}
+
+// fold applies op left to right: subtract(a, b, c) is a - b - c.
+func fold(op string, least int) Func {
+	return func(args []interface{}) (interface{}, error) {
+		if len(args) < least {
+			return nil, fmt.Errorf("expected at least %d arguments, got %d", least, len(args))
+		}
+		nums, ok, err := operands(args)
+		if err != nil || !ok {
+			return nil, err
+		}
+		acc := nums[0]
+		for _, n := range nums[1:] {
+			if acc, err = calc(op, acc, n); err != nil {
+				return nil, err
+			}
+		}
+		return acc, nil
+	}
+}
+
+// round rounds half away from zero to a number of decimal places (default 0;
+// negative rounds to tens, hundreds and so on).
+func round(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	nums, ok, err := operands(args[:1])
+	if err != nil || !ok {
+		return nil, err
+	}
+	places := 0
+	if len(args) == 2 {
+		if places, err = intArg(args[1], "precision"); err != nil {
+			return nil, err
+		}
+	}
+
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(places))), nil))
+	r, err := decimal(nums[0])
+	if err != nil {
+		return nil, err
+	}
+	if places >= 0 {
+		r.Mul(r, scale)
+	} else {
+		r.Quo(r, scale)
+	}
+
+	whole, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+	// Round away from zero when the remainder is at least half.
+	if rem.Abs(rem).Lsh(rem, 1).Cmp(r.Denom()) >= 0 {
+		whole.Add(whole, big.NewInt(int64(r.Sign())))
+	}
+
+	res := new(big.Rat).SetInt(whole)
+	if places >= 0 {
+		res.Quo(res, scale)
+	} else {
+		res.Mul(res, scale)
+	}
+	return fromDecimal(res)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func floor(args []interface{}) (interface{}, error) {
+	return mapNumber(args, math.Floor)
+}
+
+func ceil(args []interface{}) (interface{}, error) {
+	return mapNumber(args, math.Ceil)
+}
+
+func absolute(args []interface{}) (interface{}, error) {
+	return mapNumber(args, math.Abs)
+}
+
+func mapNumber(args []interface{}, fn func(float64) float64) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	nums, ok, err := operands(args)
+	if err != nil || !ok {
+		return nil, err
+	}
+	return fn(nums[0]), nil
+}
+
+// toNumber converts numbers and numeric strings; anything else is null. An
+// optional decimal separator reads localized amounts such as SWIFT's
+// "100000,50": toNumber(amount, ','). Other separators are then dropped as
+// digit grouping.
+func toNumber(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+
+	val := args[0]
+	if s, ok := val.(string); ok && len(args) == 2 {
+		sep := toText(args[1])
+		if len(sep) != 1 {
+			return nil, fmt.Errorf("decimal separator must be one character, got %s", quote(args[1]))
+		}
+		val = strings.Map(func(r rune) rune {
+			switch {
+			case r == rune(sep[0]):
+				return '.'
+			case r == '.' || r == ',' || r == ' ' || r == '\'':
+				return -1
+			}
+			return r
+		}, s)
+	}
+
+	if f, ok := ToNumber(val); ok {
+		return f, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,255 @@
+package expr
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var comparisons = map[string]bool{
+	"==": true,
+	"!=": true,
+	"<":  true,
+	"<=": true,
+	">":  true,
+	">=": true,
+	"=~": true,
+}
+
+type logical struct {
+	and         bool
+	left, right node
+}
+
+func (n *logical) eval(env *Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Short-circuit.
+	if Truthy(left) != n.and {
+		return !n.and, nil
+	}
+
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return Truthy(right), nil
+}
+
+type not struct {
+	operand node
+}
+
+func (n *not) eval(env *Env) (interface{}, error) {
+	val, err := n.operand.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	return !Truthy(val), nil
+}
+
+type comparison struct {
+	op          string
+	left, right node
+	re          *regexp.Regexp
+	pos         int
+}
+
+func (n *comparison) eval(env *Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.op {
+	case "==":
+		return equal(left, right), nil
+	case "!=":
+		return !equal(left, right), nil
+	case "=~":
+		if left == nil {
+			return false, nil
+		}
+		re := n.re
+		if re == nil {
+			pattern, ok := right.(string)
+			if !ok {
+				return nil, fmt.Errorf("=~ at position %d: pattern must be a string, got %T", n.pos, right)
+			}
+			if re, err = regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("=~ at position %d: %w", n.pos, err)
+			}
+		}
+		return re.MatchString(toText(left)), nil
+	}
+
+	c, ok := order(left, right)
+	if !ok {
+		// Missing or mismatched values never satisfy an ordering.
+		return false, nil
+	}
+	switch n.op {
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	}
+	return c >= 0, nil
+}
+
+type arithmetic struct {
+	op          string
+	left, right node
+	pos         int
+}
+
+func (n *arithmetic) eval(env *Env) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Operators do not map over lists; a list operand, even next to a
+	// missing one, is a mistake rather than a missing value.
+	for _, val := range []interface{}{left, right} {
+		if _, isList := val.([]interface{}); isList {
+			return nil, fmt.Errorf("%s at position %d: cannot apply to a list; evaluate per element with an aggregate such as sum(list, price * quantity)", n.op, n.pos)
+		}
+	}
+
+	// Missing values propagate instead of failing the whole expression.
+	if left == nil || right == nil {
+		return nil, nil
+	}
+
+	a, ok := ToNumber(left)
+	if !ok {
+		return nil, fmt.Errorf("%s at position %d: non-numeric value %s", n.op, n.pos, quote(left))
+	}
+	b, ok := ToNumber(right)
+	if !ok {
+		return nil, fmt.Errorf("%s at position %d: non-numeric value %s", n.op, n.pos, quote(right))
+	}
+
+	res, err := calc(n.op, a, b)
+	if err != nil {
+		return nil, fmt.Errorf("%s at position %d: %w", n.op, n.pos, err)
+	}
+	return res, nil
+}
+
+// quote renders a value for error messages.
+func quote(val interface{}) string {
+	if s, ok := val.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// equal compares JSON values. Numbers compare by value whatever their Go type.
+func equal(a, b interface{}) bool {
+	if af, ok := numberOf(a); ok {
+		bf, ok := numberOf(b)
+		return ok && af == bf
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// order compares two values for <, <=, > and >=. Numbers and numeric strings
+// compare numerically, other strings lexically.
+func order(a, b interface{}) (int, bool) {
+	af, aok := ToNumber(a)
+	bf, bok := ToNumber(b)
+	if aok && bok {
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return strings.Compare(as, bs), true
+	}
+	return 0, false
+}
+
+// Truthy reports whether a value counts as true in a condition: false, null,
+// zero, "" and empty arrays or objects do not.
+func Truthy(val interface{}) bool {
+	switch v := val.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	if f, ok := numberOf(val); ok {
+		return f != 0
+	}
+	return true
+}
+
+// numberOf converts Go numeric types, but not strings.
+func numberOf(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// ToNumber converts numbers and numeric strings such as "12.50". Strings
+// must be plain decimals, optionally with an exponent; Go-only spellings
+// ("0x1p4", "1_000") and non-finite values ("NaN", "Inf") are not numbers.
+func ToNumber(val interface{}) (float64, bool) {
+	if s, ok := val.(string); ok {
+		s = strings.TrimSpace(s)
+		if !decimalText.MatchString(s) {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	}
+	f, ok := numberOf(val)
+	return f, ok && !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+var decimalText = regexp.MustCompile(`^[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?$`)
@@ -0,0 +1,357 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SyntaxError reports where an expression failed to parse.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Msg, e.Pos)
+}
+
+// Expr is a parsed expression, safe to evaluate many times.
+type Expr struct {
+	src  string
+	root node
+}
+
+// Parse compiles an expression such as concat(given, ' ', @(1,family)).
+func Parse(src string) (*Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	root, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	return &Expr{src: src, root: root}, nil
+}
+
+// String returns the source the expression was parsed from.
+func (x *Expr) String() string {
+	return x.src
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(kind tokenKind, what string) (token, error) {
+	tok := p.next()
+	if tok.kind != kind {
+		return tok, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected %s, got %s", what, describe(tok))}
+	}
+	return tok, nil
+}
+
+// Precedence, loosest first: "||"/or, "&&"/and, "!"/not, comparisons,
+// "+" and "-", then "*", "/" and "%", then unary minus.
+func (p *parser) parseExpr() (node, error) {
+	return p.parseOr()
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("||", "or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("&&", "and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	if p.isOp("!", "not") {
+		p.next()
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &not{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.kind != tokOp || !comparisons[tok.text] {
+		return left, nil
+	}
+	p.next()
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	cmp := &comparison{op: tok.text, left: left, right: right, pos: tok.pos}
+	if tok.text == "=~" {
+		// Compile literal patterns up front so mistakes surface at parse time.
+		if lit, ok := right.(*literal); ok {
+			pattern, ok := lit.val.(string)
+			if !ok {
+				return nil, &SyntaxError{Pos: tok.pos, Msg: "=~ needs a string pattern"}
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("invalid pattern: %v", err)}
+			}
+			cmp.re = re
+		}
+	}
+	return cmp, nil
+}
+
+func (p *parser) parseOperand() (node, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("+", "") || p.isOp("-", "") {
+		tok := p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseTerm() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOp("*", "") || p.isOp("/", "") || p.isOp("%", "") {
+		tok := p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &arithmetic{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.isOp("-", "") {
+		tok := p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &arithmetic{op: "-", left: &literal{val: 0.0}, right: operand, pos: tok.pos}, nil
+	}
+	return p.parsePrimary()
+}
+
+// isOp reports whether the next token is the operator sym or the keyword word.
+func (p *parser) isOp(sym, word string) bool {
+	tok := p.peek()
+	return (tok.kind == tokOp && tok.text == sym) || (word != "" && tok.kind == tokIdent && tok.text == word)
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+
+	switch tok.kind {
+	case tokNumber:
+		f, err := strconv.ParseFloat(tok.text, 64)
+		if err != nil {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("invalid number %q", tok.text)}
+		}
+		return &literal{val: f}, nil
+
+	case tokString:
+		return &literal{val: tok.text}, nil
+
+	case tokRef:
+		return parseRef(tok)
+
+	case tokLParen:
+		inner, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokRParen, "\")\""); err != nil {
+			return nil, err
+		}
+		return inner, nil
+
+	case tokIdent:
+		switch tok.text {
+		case "true":
+			return &literal{val: true}, nil
+		case "false":
+			return &literal{val: false}, nil
+		case "null":
+			return &literal{val: nil}, nil
+		}
+		if p.peek().kind == tokLParen {
+			return p.parseCall(tok)
+		}
+		return p.parseField(tok)
+	}
+
+	return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %s", describe(tok))}
+}
+
+func (p *parser) parseCall(name token) (node, error) {
+	fn, eager := builtins[name.text]
+	lazy, isLazy := lazyBuiltins[name.text]
+	if !eager && !isLazy {
+		return nil, &SyntaxError{Pos: name.pos, Msg: fmt.Sprintf("unknown function %q", name.text)}
+	}
+	p.next() // "("
+
+	c := &call{name: name.text, fn: fn, lazy: lazy, pos: name.pos}
+	if p.peek().kind == tokRParen {
+		p.next()
+		return c, nil
+	}
+
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if idx, ok := patternArgs[name.text]; ok && idx == len(c.args) {
+			if lit, ok := arg.(*literal); ok && lit.val != nil {
+				re, err := compilePattern(lit.val)
+				if err != nil {
+					return nil, &SyntaxError{Pos: name.pos, Msg: fmt.Sprintf("%s: %v", name.text, err)}
+				}
+				arg = &compiledPattern{re: re}
+			}
+		}
+		c.args = append(c.args, arg)
+
+		tok := p.next()
+		if tok.kind == tokRParen {
+			return c, nil
+		}
+		if tok.kind != tokComma {
+			return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected \",\" or \")\" in call to %s, got %s", name.text, describe(tok))}
+		}
+	}
+}
+
+// parseField reads a dotted path such as address.line[0]. "[*]" projects
+// the rest of the path over every element and yields a list.
+func (p *parser) parseField(first token) (node, error) {
+	path := []string{first.text}
+
+	for {
+		switch p.peek().kind {
+		case tokDot:
+			p.next()
+			tok := p.next()
+			if tok.kind != tokIdent && tok.kind != tokNumber {
+				return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected field name after \".\", got %s", describe(tok))}
+			}
+			path = append(path, tok.text)
+
+		case tokLBracket:
+			p.next()
+			tok := p.next()
+			if tok.kind != tokNumber && !(tok.kind == tokOp && tok.text == "*") {
+				return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("expected array index or \"*\", got %s", describe(tok))}
+			}
+			if _, err := p.expect(tokRBracket, "\"]\""); err != nil {
+				return nil, err
+			}
+			path = append(path, tok.text)
+
+		default:
+			return &fieldRef{path: path}, nil
+		}
+	}
+}
+
+// parseRef decodes "@" and "@(N,path)".
+func parseRef(tok token) (node, error) {
+	ref := &ancestorRef{}
+	if tok.text == "" {
+		return ref, nil
+	}
+
+	levelStr, path, _ := strings.Cut(tok.text, ",")
+	level, err := strconv.Atoi(strings.TrimSpace(levelStr))
+	if err != nil || level < 0 {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("invalid reference level %q", levelStr)}
+	}
+
+	ref.level = level
+	ref.path = splitPath(strings.TrimSpace(path))
+	return ref, nil
+}
+
+// splitPath turns "a.b[0].c" into [a b 0 c].
+func splitPath(path string) []string {
+	return strings.FieldsFunc(path, func(r rune) bool {
+		return r == '.' || r == '[' || r == ']'
+	})
+}
+
+func describe(tok token) string {
+	if tok.kind == tokEOF {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", tok.text)
+}
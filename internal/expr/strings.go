@@ -0,0 +1,315 @@
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// String functions take their text arguments through toText, so numbers work
+// too, and return null when the text itself is null so missing fields stay
+// missing.
+
+func upper(args []interface{}) (interface{}, error) {
+	return mapText(args, strings.ToUpper)
+}
+
+func lower(args []interface{}) (interface{}, error) {
+	return mapText(args, strings.ToLower)
+}
+
+// titleCase upper-cases the first letter of each word and lower-cases the
+// rest: "mARY-jane o'neil" becomes "Mary-Jane O'neil".
+func titleCase(args []interface{}) (interface{}, error) {
+	return mapText(args, func(s string) string {
+		runes := []rune(s)
+		start := true
+		for i, r := range runes {
+			if start {
+				runes[i] = unicode.ToUpper(r)
+			} else {
+				runes[i] = unicode.ToLower(r)
+			}
+			start = unicode.IsSpace(r) || r == '-'
+		}
+		return string(runes)
+	})
+}
+
+func mapText(args []interface{}, fn func(string) string) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	return fn(toText(args[0])), nil
+}
+
+// trim removes surrounding whitespace, or the characters in its second
+// argument.
+func trim(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 2); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	if len(args) == 2 {
+		return strings.Trim(toText(args[0]), toText(args[1])), nil
+	}
+	return strings.TrimSpace(toText(args[0])), nil
+}
+
+// substring returns the characters from start up to end (exclusive, default
+// the end of the text). Negative positions count from the end and positions
+// past either end are clamped.
+func substring(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	runes := []rune(toText(args[0]))
+	start, err := intArg(args[1], "start")
+	if err != nil {
+		return nil, err
+	}
+	end := len(runes)
+	if len(args) == 3 {
+		if end, err = intArg(args[2], "end"); err != nil {
+			return nil, err
+		}
+	}
+
+	start, end = clampIndex(start, len(runes)), clampIndex(end, len(runes))
+	if start >= end {
+		return "", nil
+	}
+	return string(runes[start:end]), nil
+}
+
+// clampIndex resolves a possibly negative position into [0, n].
+func clampIndex(i, n int) int {
+	if i < 0 {
+		i += n
+	}
+	if i < 0 {
+		return 0
+	}
+	if i > n {
+		return n
+	}
+	return i
+}
+
+// split breaks text on a separator; an empty separator splits characters.
+func split(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	parts := strings.Split(toText(args[0]), toText(args[1]))
+	out := make([]interface{}, len(parts))
+	for i, part := range parts {
+		out[i] = part
+	}
+	return out, nil
+}
+
+// join renders the elements of a list as text separated by its second
+// argument, skipping nulls.
+func join(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+
+	var items []interface{}
+	switch v := args[0].(type) {
+	case nil:
+		return nil, nil
+	case []interface{}:
+		items = v
+	default:
+		items = []interface{}{v}
+	}
+
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		if item != nil {
+			parts = append(parts, toText(item))
+		}
+	}
+	return strings.Join(parts, toText(args[1])), nil
+}
+
+// replace substitutes every occurrence of old.
+func replace(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 3, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+	return strings.ReplaceAll(toText(args[0]), toText(args[1]), toText(args[2])), nil
+}
+
+func padLeft(args []interface{}) (interface{}, error) {
+	return pad(args, true)
+}
+
+func padRight(args []interface{}) (interface{}, error) {
+	return pad(args, false)
+}
+
+// pad extends text to a width in characters with a pad string, a space by
+// default. Longer text is returned unchanged.
+func pad(args []interface{}, left bool) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	text := toText(args[0])
+	width, err := intArg(args[1], "width")
+	if err != nil {
+		return nil, err
+	}
+	fill := " "
+	if len(args) == 3 {
+		fill = toText(args[2])
+		if fill == "" {
+			return nil, fmt.Errorf("pad text must not be empty")
+		}
+	}
+
+	missing := width - len([]rune(text))
+	if missing <= 0 {
+		return text, nil
+	}
+	fillRunes := []rune(strings.Repeat(fill, missing/len([]rune(fill))+1))
+	padding := string(fillRunes[:missing])
+	if left {
+		return padding + text, nil
+	}
+	return text + padding, nil
+}
+
+func startsWith(args []interface{}) (interface{}, error) {
+	return testText(args, strings.HasPrefix)
+}
+
+func endsWith(args []interface{}) (interface{}, error) {
+	return testText(args, strings.HasSuffix)
+}
+
+func testText(args []interface{}, fn func(s, affix string) bool) (interface{}, error) {
+	if err := checkArgs(args, 2, 2); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return false, nil
+	}
+	return fn(toText(args[0]), toText(args[1])), nil
+}
+
+// length counts the characters of text or the elements of a list or object.
+// Null has length 0.
+func length(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 1, 1); err != nil {
+		return nil, err
+	}
+	switch v := args[0].(type) {
+	case nil:
+		return 0.0, nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return float64(len([]rune(toText(args[0])))), nil
+}
+
+// regexExtract returns the first match of a pattern, or of one of its
+// capture groups, and null when nothing matches.
+func regexExtract(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 2, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	re, err := compilePattern(args[1])
+	if err != nil {
+		return nil, err
+	}
+	group := 0
+	if len(args) == 3 {
+		if group, err = intArg(args[2], "group"); err != nil {
+			return nil, err
+		}
+		if group < 0 || group > re.NumSubexp() {
+			return nil, fmt.Errorf("pattern has no group %d", group)
+		}
+	}
+
+	m := re.FindStringSubmatchIndex(toText(args[0]))
+	if m == nil || m[2*group] < 0 {
+		return nil, nil
+	}
+	return toText(args[0])[m[2*group]:m[2*group+1]], nil
+}
+
+// regexReplace replaces every match of a pattern. The replacement may use
+// $1 or ${name} to insert capture groups.
+func regexReplace(args []interface{}) (interface{}, error) {
+	if err := checkArgs(args, 3, 3); err != nil {
+		return nil, err
+	}
+	if args[0] == nil {
+		return nil, nil
+	}
+
+	re, err := compilePattern(args[1])
+	if err != nil {
+		return nil, err
+	}
+	return re.ReplaceAllString(toText(args[0]), toText(args[2])), nil
+}
+
+// patternArgs lists the functions that take a regular expression and the
+// position of that argument. A literal pattern is compiled at parse time, like
+// the right side of "=~"; a computed one is compiled on every call.
+var patternArgs = map[string]int{
+	"regexExtract": 1,
+	"regexReplace": 1,
+}
+
+// compiledPattern is a literal pattern argument, compiled by the parser.
+type compiledPattern struct {
+	re *regexp.Regexp
+}
+
+func (n *compiledPattern) eval(*Env) (interface{}, error) {
+	return n.re, nil
+}
+
+func compilePattern(arg interface{}) (*regexp.Regexp, error) {
+	if re, ok := arg.(*regexp.Regexp); ok {
+		return re, nil
+	}
+	re, err := regexp.Compile(toText(arg))
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %v", err)
+	}
+	return re, nil
+}
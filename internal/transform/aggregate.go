@@ -0,0 +1,67 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iammehrabsandhu/jmap/internal/expr"
+)
+
+// applyAggregate writes computed values, typically totals over arrays.
+// The spec maps target paths to expressions such as
+// {"subtotal": "sum(line_items, price * quantity)"}. Each expression is
+// evaluated against the object the target is written into, so a wildcard
+// target like "orders[*].total" computes one value per order.
+func (e *Engine) applyAggregate(input interface{}, spec interface{}) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid aggregate spec: expected map, got %T", spec)
+	}
+
+	// Sort targets for deterministic output.
+	targets := make([]string, 0, len(specMap))
+	for t := range specMap {
+		targets = append(targets, t)
+	}
+	sort.Strings(targets)
+
+	current := input
+	for _, target := range targets {
+		src, ok := specMap[target].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid aggregate for %s: expected expression string, got %T", target, specMap[target])
+		}
+		x, err := expr.Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("aggregate %s: %w", target, err)
+		}
+
+		segments := parsePath(target)
+		if len(segments) == 0 {
+			return nil, fmt.Errorf("aggregate: empty target path")
+		}
+		field := segments[len(segments)-1]
+
+		current, err = e.updatePath(current, joinPath(segments[:len(segments)-1]), func(val interface{}, at pathMatch) (interface{}, error) {
+			holder, ok := val.(map[string]interface{})
+			if !ok {
+				return val, nil
+			}
+
+			res, err := x.Eval(&expr.Env{
+				Stack:  append(at.parents, holder),
+				Fields: holder,
+			})
+			if err != nil {
+				return nil, err
+			}
+			holder[field] = res
+			return holder, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("aggregate %s: %w", target, err)
+		}
+	}
+
+	return current, nil
+}
@@ -0,0 +1,123 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// applyCardinality forces values to be single items or lists.
+// The spec mirrors the input tree like remove: a leaf "ONE" replaces an array
+// with its first element and "MANY" wraps any other value in an array. "*"
+// matches every key or element, numeric keys address array indices and "@"
+// applies to the value at the current level before its children are visited.
+func (e *Engine) applyCardinality(input interface{}, spec interface{}) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid cardinality spec: expected map, got %T", spec)
+	}
+	return e.processCardinality(input, specMap)
+}
+
+func (e *Engine) processCardinality(input interface{}, spec map[string]interface{}) (interface{}, error) {
+	// "@" reshapes this level first so children see the normalized value.
+	if atSpec, ok := spec["@"]; ok {
+		mode, ok := atSpec.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid cardinality spec for @: expected ONE or MANY, got %T", atSpec)
+		}
+		var err error
+		if input, err = toCardinality(input, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sort keys for deterministic output.
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		if k != "@" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	switch in := input.(type) {
+	case map[string]interface{}:
+		for _, key := range keys {
+			matched := []string{key}
+			if key == "*" {
+				matched = make([]string, 0, len(in))
+				for k := range in {
+					matched = append(matched, k)
+				}
+			}
+
+			for _, k := range matched {
+				val, exists := in[k]
+				if !exists {
+					continue
+				}
+				res, err := e.cardinalityField(val, spec[key])
+				if err != nil {
+					return nil, err
+				}
+				in[k] = res
+			}
+		}
+		return in, nil
+
+	case []interface{}:
+		for _, key := range keys {
+			var matched []int
+			if key == "*" {
+				for i := range in {
+					matched = append(matched, i)
+				}
+			} else if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(in) {
+				matched = append(matched, idx)
+			}
+
+			for _, i := range matched {
+				res, err := e.cardinalityField(in[i], spec[key])
+				if err != nil {
+					return nil, err
+				}
+				in[i] = res
+			}
+		}
+		return in, nil
+	}
+
+	return input, nil
+}
+
+func (e *Engine) cardinalityField(val interface{}, specVal interface{}) (interface{}, error) {
+	switch s := specVal.(type) {
+	case string:
+		return toCardinality(val, s)
+	case map[string]interface{}:
+		return e.processCardinality(val, s)
+	}
+	return nil, fmt.Errorf("invalid cardinality spec: expected ONE, MANY or map, got %T", specVal)
+}
+
+// toCardinality reshapes a single value. Nulls are left alone.
+func toCardinality(val interface{}, mode string) (interface{}, error) {
+	switch strings.ToUpper(mode) {
+	case "ONE":
+		if arr, ok := val.([]interface{}); ok {
+			if len(arr) == 0 {
+				return nil, nil
+			}
+			return arr[0], nil
+		}
+		return val, nil
+	case "MANY":
+		if _, ok := val.([]interface{}); ok || val == nil {
+			return val, nil
+		}
+		return []interface{}{val}, nil
+	}
+	return nil, fmt.Errorf("unknown cardinality %q: expected ONE or MANY", mode)
+}
@@ -0,0 +1,209 @@
+package transform
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/iammehrabsandhu/jmap/internal/expr"
+)
+
+// coerceConfig describes one coerce operation.
+type coerceConfig struct {
+	// fields maps paths (with "*" wildcards) to target types.
+	fields map[string]string
+	// truthy and falsy hold the lower-cased texts "bool" accepts.
+	truthy map[string]bool
+	falsy  map[string]bool
+	// skipErrors leaves unconvertible values as they are instead of failing.
+	skipErrors bool
+}
+
+var (
+	defaultTruthy = []string{"true", "yes", "y", "1", "on"}
+	defaultFalsy  = []string{"false", "no", "n", "0", "off"}
+)
+
+// applyCoerce converts field values to other JSON types:
+// {"fields": {"items[*].qty": "int", "active": "bool"}, "onError": "skip"}.
+// Types are "string", "int", "float", "bool", "null-if-empty" and "array".
+// "truthy" and "falsy" replace the texts bool accepts (case-insensitive).
+// Nulls are left alone. An unconvertible value fails the transform unless
+// onError is "skip", which keeps it unchanged.
+func (e *Engine) applyCoerce(input interface{}, spec interface{}) (interface{}, error) {
+	cfg, err := parseCoerceConfig(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid coerce spec: %w", err)
+	}
+
+	// Sort paths for deterministic output.
+	paths := make([]string, 0, len(cfg.fields))
+	for p := range cfg.fields {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	current := input
+	for _, path := range paths {
+		target := cfg.fields[path]
+		current, err = e.updatePath(current, path, func(val interface{}, _ pathMatch) (interface{}, error) {
+			res, err := coerceValue(val, target, cfg)
+			if err != nil {
+				if cfg.skipErrors {
+					return val, nil
+				}
+				return nil, err
+			}
+			return res, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("coerce %s: %w", path, err)
+		}
+	}
+
+	return current, nil
+}
+
+func parseCoerceConfig(spec interface{}) (coerceConfig, error) {
+	cfg := coerceConfig{fields: make(map[string]string)}
+
+	m, ok := spec.(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("expected map, got %T", spec)
+	}
+	if err := checkKeys(m, "fields", "truthy", "falsy", "onError"); err != nil {
+		return cfg, err
+	}
+
+	fields, ok := m["fields"].(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("needs a \"fields\" map of paths to types")
+	}
+	for path, raw := range fields {
+		target, _ := raw.(string)
+		switch target {
+		case "string", "int", "float", "bool", "null-if-empty", "array":
+			cfg.fields[path] = target
+		default:
+			return cfg, fmt.Errorf("unknown type %v for %s", raw, path)
+		}
+	}
+
+	var err error
+	if cfg.truthy, err = parseTextSet(m, "truthy", defaultTruthy); err != nil {
+		return cfg, err
+	}
+	if cfg.falsy, err = parseTextSet(m, "falsy", defaultFalsy); err != nil {
+		return cfg, err
+	}
+
+	switch policy := m["onError"]; policy {
+	case nil, "error":
+	case "skip":
+		cfg.skipErrors = true
+	default:
+		return cfg, fmt.Errorf("unknown error policy %v", policy)
+	}
+
+	return cfg, nil
+}
+
+// parseTextSet reads an optional list of texts, falling back to def.
+func parseTextSet(m map[string]interface{}, name string, def []string) (map[string]bool, error) {
+	raw, exists := m[name]
+	if !exists {
+		return textSet(def), nil
+	}
+	list, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be a list, got %T", name, raw)
+	}
+	texts := make([]string, 0, len(list))
+	for _, item := range list {
+		texts = append(texts, valueKey(item))
+	}
+	return textSet(texts), nil
+}
+
+func textSet(texts []string) map[string]bool {
+	set := make(map[string]bool, len(texts))
+	for _, t := range texts {
+		set[strings.ToLower(t)] = true
+	}
+	return set
+}
+
+// coerceValue converts one value to target.
+func coerceValue(val interface{}, target string, cfg coerceConfig) (interface{}, error) {
+	if val == nil {
+		return nil, nil
+	}
+
+	switch target {
+	case "null-if-empty":
+		switch v := val.(type) {
+		case string:
+			if strings.TrimSpace(v) == "" {
+				return nil, nil
+			}
+		case []interface{}:
+			if len(v) == 0 {
+				return nil, nil
+			}
+		case map[string]interface{}:
+			if len(v) == 0 {
+				return nil, nil
+			}
+		}
+		return val, nil
+
+	case "array":
+		return toCardinality(val, "MANY")
+	}
+
+	switch val.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil, fmt.Errorf("cannot convert %T to %s", val, target)
+	}
+
+	switch target {
+	case "string":
+		return valueKey(val), nil
+
+	case "bool":
+		text := strings.ToLower(strings.TrimSpace(valueKey(val)))
+		switch {
+		case cfg.truthy[text]:
+			return true, nil
+		case cfg.falsy[text]:
+			return false, nil
+		}
+		return nil, fmt.Errorf("cannot convert %q to bool", valueKey(val))
+
+	case "int", "float":
+		var n float64
+		switch v := val.(type) {
+		case float64:
+			n = v
+		case bool:
+			if v {
+				n = 1
+			}
+		case string:
+			f, ok := expr.ToNumber(v)
+			if !ok {
+				return nil, fmt.Errorf("cannot convert %q to %s", v, target)
+			}
+			n = f
+		default:
+			return nil, fmt.Errorf("cannot convert %T to %s", val, target)
+		}
+		if target == "int" && n != math.Trunc(n) {
+			return nil, fmt.Errorf("cannot convert %s to int without losing the fraction", valueKey(n))
+		}
+		return n, nil
+	}
+
+	return nil, fmt.Errorf("unknown type %s", target)
+}
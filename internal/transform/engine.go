@@ -1,12 +1,14 @@
 package transform
 
 import (
+	"errors"
 	"fmt"
 	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/iammehrabsandhu/jmap/internal/expr"
 	"github.com/iammehrabsandhu/jmap/types"
 )
 
@@ -23,9 +25,35 @@ func (e *Engine) Transform(input interface{}, spec *types.TransformSpec) (interf
 	for _, op := range spec.Operations {
 		switch op.Type {
 		case "shift":
-			current, err = e.applyShift(current, op.Spec)
+			current, err = e.applyShift(current, op.Spec, op.Passthrough)
 		case "default":
 			current, err = e.applyDefault(current, op.Spec)
+		case "remove":
+			current, err = e.applyRemove(current, op.Spec)
+		case "sort":
+			current, err = e.applySort(current, op.Spec)
+		case "cardinality":
+			current, err = e.applyCardinality(current, op.Spec)
+		case "modify-overwrite":
+			current, err = e.applyModify(current, op.Spec, true)
+		case "modify-default":
+			current, err = e.applyModify(current, op.Spec, false)
+		case "filter":
+			current, err = e.applyFilter(current, op.Spec)
+		case "groupBy":
+			current, err = e.applyGroupBy(current, op.Spec)
+		case "aggregate":
+			current, err = e.applyAggregate(current, op.Spec)
+		case "flatten":
+			current, err = e.applyFlatten(current, op.Spec)
+		case "unflatten":
+			current, err = e.applyUnflatten(current, op.Spec)
+		case "merge":
+			current, err = e.applyMerge(current, op.Spec)
+		case "rename":
+			current, err = e.applyRename(current, op.Spec)
+		case "coerce":
+			current, err = e.applyCoerce(current, op.Spec)
 		default:
 			return nil, fmt.Errorf("unknown operation type: %s", op.Type)
 		}
@@ -38,25 +66,86 @@ func (e *Engine) Transform(input interface{}, spec *types.TransformSpec) (interf
 	return current, nil
 }
 
-func (e *Engine) applyShift(input interface{}, spec interface{}) (interface{}, error) {
-	output := make(map[string]interface{})
-	if err := e.processShift(input, spec, output, []string{}); err != nil {
+// applyShift builds a new document from the spec's mappings. With passthrough
+// set, input fields the spec never matched are copied over at their original
+// paths; mapped values win on conflicts.
+func (e *Engine) applyShift(input interface{}, spec interface{}, passthrough bool) (interface{}, error) {
+	output := &shiftOutput{
+		root:     make(map[string]interface{}),
+		appended: make(map[appendSlot]int),
+		exprs:    make(map[string]*expr.Expr),
+		patterns: make(map[string]*regexp.Regexp),
+	}
+	if passthrough {
+		output.consumed = make(map[string]bool)
+	}
+	// The root level has no key; it only anchors "@" lookups.
+	root := []shiftLevel{{value: input, path: []string{}}}
+	if err := e.processShift(input, spec, output, root); err != nil {
 		return nil, err
 	}
-	return output, nil
+
+	result := copyValue(output.root)
+	if passthrough {
+		if rest, ok := unconsumed(input, []string{}, output.consumed); ok {
+			result = mergePassthrough(result, rest)
+		}
+	}
+	return result, nil
+}
+
+// shiftOutput is the document a shift writes into.
+type shiftOutput struct {
+	root map[string]interface{}
+
+	// appended remembers the element "[]" created in each array for each
+	// input object, so sibling "list[].field" paths share one element.
+	appended map[appendSlot]int
+
+	// exprs caches the "@name(...)" calls parsed from output paths.
+	exprs map[string]*expr.Expr
+
+	// patterns caches the compiled form of "*" pattern keys.
+	patterns map[string]*regexp.Regexp
+
+	// consumed holds the input paths written somewhere, keyed by
+	// consumedKey. Only set for passthrough shifts.
+	consumed map[string]bool
+}
+
+type appendSlot struct {
+	arr   *[]interface{}
+	scope string
 }
 
-func (e *Engine) processShift(input interface{}, spec interface{}, output map[string]interface{}, keyStack []string) error {
+// shiftLevel is one step of the input walk: the key that matched and the
+// value under it. "&" reads keys and "@" reads values from the stack.
+type shiftLevel struct {
+	key   string
+	value interface{}
+
+	// captures holds what each "*" of a pattern key such as "addr_*"
+	// matched; "&(N,1)" reads the first one.
+	captures []string
+
+	// path locates value in the input document. It is nil for values that
+	// do not come from the walk, such as literals and "@(N,path)" reads.
+	path []string
+}
+
+// pushLevel appends without sharing the backing array between siblings.
+func pushLevel(stack []shiftLevel, level shiftLevel) []shiftLevel {
+	out := make([]shiftLevel, len(stack), len(stack)+1)
+	copy(out, stack)
+	return append(out, level)
+}
+
+func (e *Engine) processShift(input interface{}, spec interface{}, output *shiftOutput, stack []shiftLevel) error {
 	specMap, ok := spec.(map[string]interface{})
 	if !ok {
 		return fmt.Errorf("invalid shift spec: expected map, got %T", spec)
 	}
 
-	inputMap, ok := input.(map[string]interface{})
-	if !ok {
-		return nil
-	}
-
 	// Sort keys for deterministic output.
 	keys := make([]string, 0, len(specMap))
 	for k := range specMap {
@@ -64,89 +153,315 @@ func (e *Engine) processShift(input interface{}, spec interface{}, output map[st
 	}
 	sort.Strings(keys)
 
+	// Maps and arrays match keys; anything else is matched by its value.
+	scalar := true
+	switch input.(type) {
+	case map[string]interface{}, []interface{}:
+		scalar = false
+	}
+
 	for _, key := range keys {
 		specVal := specMap[key]
 
+		// "@" and "@(N,path)" read a value instead of matching an input key.
+		// They keep the current key so "&" resolves like it does for siblings.
+		if key == "@" || strings.HasPrefix(key, "@(") {
+			val, found, err := e.resolveReference(key, stack)
+			if err != nil {
+				return err
+			}
+			if !found {
+				continue
+			}
+			level := shiftLevel{key: stack[len(stack)-1].key, value: val}
+			if key == "@" {
+				level.path = stack[len(stack)-1].path
+			}
+			if err := e.processField(val, level.key, specVal, output, pushLevel(stack, level)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// "#value" writes the literal text after "#" each time this level matches.
+		if strings.HasPrefix(key, "#") {
+			literal := key[1:]
+			if err := e.processField(literal, literal, specVal, output, pushLevel(stack, shiftLevel{key: literal, value: literal})); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// "$" and "$N" write a key from the input walk as the value.
+		if level, ok := parseKeyReference(key); ok {
+			idx := len(stack) - 1 - level
+			if idx < 1 {
+				// The root has no key to write.
+				continue
+			}
+			name := stack[idx].key
+			if err := e.processField(name, name, specVal, output, pushLevel(stack, shiftLevel{key: name, value: name})); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if scalar {
+			// Routed by processValueMatch below.
+			continue
+		}
+
+		for _, m := range output.matchKeys(input, key) {
+			m.path = childPath(stack[len(stack)-1].path, m.key)
+			if err := e.processField(m.value, m.key, specVal, output, pushLevel(stack, m)); err != nil {
+				return err
+			}
+		}
+	}
+
+	if scalar {
+		return e.processValueMatch(input, specMap, keys, output, stack)
+	}
+	return nil
+}
+
+// processValueMatch routes a scalar by its value. Spec keys are compared
+// against the value's text ("premium", "true", "null", "42") and only the
+// best one fires: an exact key beats a pattern, which beats "*".
+func (e *Engine) processValueMatch(input interface{}, specMap map[string]interface{}, keys []string, output *shiftOutput, stack []shiftLevel) error {
+	text := valueKey(input)
+
+	best, bestRank := "", 0
+	for _, key := range keys {
+		if isSpecialKey(key) {
+			continue
+		}
+		if rank := output.valueMatchRank(key, text); rank > bestRank {
+			best, bestRank = key, rank
+		}
+	}
+	if bestRank == 0 {
+		return nil
+	}
+
+	// Reuse key matching so pattern captures work for values too.
+	matched := output.matchKeys(map[string]interface{}{text: input}, best)
+	if len(matched) == 0 {
+		return nil
+	}
+	matched[0].path = stack[len(stack)-1].path
+	return e.processField(input, text, specMap[best], output, pushLevel(stack, matched[0]))
+}
+
+// valueMatchRank scores how specifically key matches text: 3 for an exact
+// key, 2 for a pattern, 1 for "*" and 0 for no match.
+func (o *shiftOutput) valueMatchRank(key, text string) int {
+	best := 0
+	for _, alt := range strings.Split(key, "|") {
+		rank := 0
+		switch {
+		case alt == text:
+			rank = 3
+		case alt == "*":
+			rank = 1
+		case strings.Contains(alt, "*") && o.keyPattern(alt).MatchString(text):
+			rank = 2
+		}
+		if rank > best {
+			best = rank
+		}
+	}
+	return best
+}
+
+// valueKey renders a scalar the way value-matching spec keys spell it.
+func valueKey(val interface{}) string {
+	switch v := val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// isSpecialKey reports whether key reads a value, key or literal instead of
+// matching input.
+func isSpecialKey(key string) bool {
+	if key == "@" || strings.HasPrefix(key, "@(") || strings.HasPrefix(key, "#") {
+		return true
+	}
+	_, ok := parseKeyReference(key)
+	return ok
+}
+
+// matchKeys returns the children of input selected by a spec key: every
+// child for "*", keys matching a pattern such as "addr_*" or "*-Id",
+// otherwise the key itself or, for arrays, the numeric index. "a|b|c"
+// matches each alternative as if it were written as a separate key.
+func (o *shiftOutput) matchKeys(input interface{}, key string) []shiftLevel {
+	var matched []shiftLevel
+
+	if strings.Contains(key, "|") {
+		for _, alt := range strings.Split(key, "|") {
+			matched = append(matched, o.matchKeys(input, alt)...)
+		}
+		return matched
+	}
+
+	if key != "*" && strings.Contains(key, "*") {
+		pattern := o.keyPattern(key)
+
+		switch in := input.(type) {
+		case map[string]interface{}:
+			inputKeys := make([]string, 0, len(in))
+			for k := range in {
+				inputKeys = append(inputKeys, k)
+			}
+			sort.Strings(inputKeys)
+
+			for _, k := range inputKeys {
+				if sub := pattern.FindStringSubmatch(k); sub != nil {
+					matched = append(matched, shiftLevel{key: k, value: in[k], captures: sub[1:]})
+				}
+			}
+		case []interface{}:
+			for i, item := range in {
+				k := strconv.Itoa(i)
+				if sub := pattern.FindStringSubmatch(k); sub != nil {
+					matched = append(matched, shiftLevel{key: k, value: item, captures: sub[1:]})
+				}
+			}
+		}
+		return matched
+	}
+
+	switch in := input.(type) {
+	case map[string]interface{}:
 		if key == "*" {
 			// Sort input keys too.
-			inputKeys := make([]string, 0, len(inputMap))
-			for k := range inputMap {
+			inputKeys := make([]string, 0, len(in))
+			for k := range in {
 				inputKeys = append(inputKeys, k)
 			}
 			sort.Strings(inputKeys)
 
 			for _, k := range inputKeys {
-				v := inputMap[k]
-				newStack := append(keyStack, k)
-				if err := e.processField(v, k, specVal, output, newStack); err != nil {
-					return err
-				}
+				matched = append(matched, shiftLevel{key: k, value: in[k]})
 			}
-			continue
+		} else if val, exists := in[key]; exists {
+			matched = append(matched, shiftLevel{key: key, value: val})
 		}
 
-		// Exact match.
-		if val, exists := inputMap[key]; exists {
-			newStack := append(keyStack, key)
-			if err := e.processField(val, key, specVal, output, newStack); err != nil {
-				return err
+	case []interface{}:
+		if key == "*" {
+			for i, item := range in {
+				matched = append(matched, shiftLevel{key: strconv.Itoa(i), value: item})
 			}
+		} else if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(in) {
+			matched = append(matched, shiftLevel{key: key, value: in[idx]})
 		}
 	}
 
-	return nil
+	return matched
 }
 
-func (e *Engine) processField(val interface{}, key string, specVal interface{}, output map[string]interface{}, keyStack []string) error {
+// keyPattern turns a key with "*" wildcards into an anchored regexp with one
+// capture group per "*", compiled once per shift. Groups are non-greedy so
+// captures split as early as possible: "a*b*c" against "a1b2b3c" captures
+// "1" and "2b3".
+func (o *shiftOutput) keyPattern(key string) *regexp.Regexp {
+	if re, ok := o.patterns[key]; ok {
+		return re
+	}
+	parts := strings.Split(key, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	re := regexp.MustCompile("^" + strings.Join(parts, "(.*?)") + "$")
+	o.patterns[key] = re
+	return re
+}
+
+// parseKeyReference reports whether key is "$" or "$N" and returns N.
+func parseKeyReference(key string) (int, bool) {
+	if !strings.HasPrefix(key, "$") {
+		return 0, false
+	}
+	if key == "$" {
+		return 0, true
+	}
+	level, err := strconv.Atoi(key[1:])
+	if err != nil || level < 0 {
+		return 0, false
+	}
+	return level, true
+}
+
+// resolveReference evaluates "@" (the current value) or "@(N,path)" (path
+// inside the value N levels up; "@(0)" is the current value).
+func (e *Engine) resolveReference(ref string, stack []shiftLevel) (interface{}, bool, error) {
+	level, path := 0, ""
+	if ref != "@" {
+		if !strings.HasSuffix(ref, ")") {
+			return nil, false, fmt.Errorf("invalid reference %q: missing closing parenthesis", ref)
+		}
+		levelStr, rest, _ := strings.Cut(ref[2:len(ref)-1], ",")
+		n, err := strconv.Atoi(strings.TrimSpace(levelStr))
+		if err != nil || n < 0 {
+			return nil, false, fmt.Errorf("invalid reference %q: bad level %q", ref, levelStr)
+		}
+		level, path = n, strings.TrimSpace(rest)
+	}
+
+	idx := len(stack) - 1 - level
+	if idx < 0 {
+		return nil, false, nil
+	}
+
+	val, found := lookupPath(stack[idx].value, path)
+	return val, found, nil
+}
+
+func (e *Engine) processField(val interface{}, key string, specVal interface{}, output *shiftOutput, stack []shiftLevel) error {
+	switch specVal.(type) {
+	case string, []interface{}:
+		output.consume(stack[len(stack)-1].path)
+	}
+
 	switch s := specVal.(type) {
 	case string:
-		// Direct mapping or function.
-		path := s
-		if res := e.evaluateFunction(s, val); res != nil {
-			path = fmt.Sprintf("%v", res)
+		// Direct mapping, possibly with "@name(...)" calls.
+		path, ok, err := e.expandFunctions(s, output, stack)
+		if err != nil || !ok {
+			return err
 		}
-		e.placeValue(output, path, val, keyStack)
+		e.placeValue(output, path, val, stack)
 	case []interface{}:
 		// Multiple mappings.
 		for _, item := range s {
-			if str, ok := item.(string); ok {
-				e.placeValue(output, str, val, keyStack)
+			str, ok := item.(string)
+			if !ok {
+				continue
 			}
-		}
-	case map[string]interface{}:
-		if nestedMap, ok := val.(map[string]interface{}); ok {
-			if err := e.processShift(nestedMap, s, output, keyStack); err != nil {
+			path, ok, err := e.expandFunctions(str, output, stack)
+			if err != nil {
 				return err
 			}
-		} else if nestedArr, ok := val.([]interface{}); ok {
-			// for array input iterate spec for "*" or indices.
-			for k, v := range s {
-				if k == "*" {
-					// Wildcard: all items.
-					for i, item := range nestedArr {
-						newStack := append(keyStack, fmt.Sprintf("%d", i))
-						if err := e.processField(item, fmt.Sprintf("%d", i), v, output, newStack); err != nil {
-							return err
-						}
-					}
-				} else {
-					// Specific index.
-					if idx, err := strconv.Atoi(k); err == nil {
-						if idx >= 0 && idx < len(nestedArr) {
-							newStack := append(keyStack, k)
-							if err := e.processField(nestedArr[idx], k, v, output, newStack); err != nil {
-								return err
-							}
-						}
-					}
-				}
+			if ok {
+				e.placeValue(output, path, val, stack)
 			}
 		}
+	case map[string]interface{}:
+		// Nested objects match keys, arrays match "*" or indices.
+		return e.processShift(val, s, output, stack)
 	}
 	return nil
 }
 
-func (e *Engine) placeValue(output map[string]interface{}, path string, val interface{}, keyStack []string) {
+func (e *Engine) placeValue(output *shiftOutput, path string, val interface{}, stack []shiftLevel) {
 	// Handle "&" lookup.
 	// & = &0 = current key (last in stack)
 	// &1 = parent key (second to last)
@@ -161,6 +476,21 @@ func (e *Engine) placeValue(output map[string]interface{}, path string, val inte
 		n := len(path)
 		for i := 0; i < n; i++ {
 			if path[i] == '&' {
+				// "&(N,M)" reads capture group M of level N.
+				if i+1 < n && path[i+1] == '(' {
+					if end := strings.IndexByte(path[i:], ')'); end > 0 {
+						token := path[i : i+end+1]
+						if part, ok := captureGroup(stack, token[2:len(token)-1]); ok {
+							newPath.WriteString(part)
+						} else {
+							// Out of bounds, keep original token
+							newPath.WriteString(token)
+						}
+						i += end
+						continue
+					}
+				}
+
 				// Check for number
 				j := i + 1
 				numStart := j
@@ -182,9 +512,10 @@ func (e *Engine) placeValue(output map[string]interface{}, path string, val inte
 				// stack: [root, ..., parent, current]
 				// level 0 = current = len-1
 				// level 1 = parent = len-2
-				stackIdx := len(keyStack) - 1 - level
-				if stackIdx >= 0 && stackIdx < len(keyStack) {
-					newPath.WriteString(keyStack[stackIdx])
+				// The root level has no key, so it is out of bounds too.
+				stackIdx := len(stack) - 1 - level
+				if stackIdx >= 1 && stackIdx < len(stack) {
+					newPath.WriteString(stack[stackIdx].key)
 				} else {
 					// Out of bounds, keep original token
 					newPath.WriteString(path[numStart-1 : j])
@@ -196,7 +527,7 @@ func (e *Engine) placeValue(output map[string]interface{}, path string, val inte
 		path = newPath.String()
 	}
 
-	var current interface{} = output
+	var current interface{} = output.root
 
 	// Helper to set value in map or array
 	// We need to parse the path into segments.
@@ -207,6 +538,27 @@ func (e *Engine) placeValue(output map[string]interface{}, path string, val inte
 	for i, seg := range segments {
 		isLast := i == len(segments)-1
 
+		// "[]" appends. Mid-path it picks the element appended for the
+		// input object being walked, creating it on first use.
+		if seg == "[]" {
+			arr, ok := current.(*[]interface{})
+			if !ok {
+				return
+			}
+			if isLast {
+				*arr = append(*arr, val)
+				return
+			}
+
+			slot := appendSlot{arr: arr, scope: appendScope(stack)}
+			idx, exists := output.appended[slot]
+			if !exists {
+				idx = len(*arr)
+				output.appended[slot] = idx
+			}
+			seg = fmt.Sprintf("[%d]", idx)
+		}
+
 		if isLast {
 			e.setValue(current, seg, val)
 		} else {
@@ -218,6 +570,55 @@ func (e *Engine) placeValue(output map[string]interface{}, path string, val inte
 	}
 }
 
+// captureGroup resolves the "N,M" of "&(N,M)". Group 0 is the whole key and
+// "&(N)" is the same as "&N".
+func captureGroup(stack []shiftLevel, args string) (string, bool) {
+	levelStr, groupStr, hasGroup := strings.Cut(args, ",")
+	level, err := strconv.Atoi(strings.TrimSpace(levelStr))
+	if err != nil {
+		return "", false
+	}
+	group := 0
+	if hasGroup {
+		if group, err = strconv.Atoi(strings.TrimSpace(groupStr)); err != nil {
+			return "", false
+		}
+	}
+
+	stackIdx := len(stack) - 1 - level
+	if stackIdx < 1 || stackIdx >= len(stack) || group < 0 {
+		return "", false
+	}
+
+	current := stack[stackIdx]
+	if group == 0 {
+		return current.key, true
+	}
+	if group > len(current.captures) {
+		return "", false
+	}
+	return current.captures[group-1], true
+}
+
+// appendScope identifies the input record a value was matched in: every
+// level except the matched key itself, unless that key is an array index,
+// since each array element is a record of its own.
+func appendScope(stack []shiftLevel) string {
+	end := len(stack) - 1
+	if end >= 1 {
+		if _, ok := stack[end-1].value.([]interface{}); ok {
+			end++
+		}
+	}
+
+	var sb strings.Builder
+	for i := 1; i < end; i++ {
+		sb.WriteString(stack[i].key)
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
+
 // nolint: staticcheck
 func parsePath(path string) []string {
 	var segments []string
@@ -333,165 +734,222 @@ func (e *Engine) ensureContainer(container interface{}, key string, nextKey stri
 	return nil
 }
 
+// copyValue deep-copies a JSON value.
+// Shift output shares values with its input, can hold the same value at
+// several paths and grows arrays through *[]interface{}; copying gives later
+// operations plain values they can mutate safely.
+func copyValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = copyValue(item)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(v))
+		for i, item := range v {
+			arr[i] = copyValue(item)
+		}
+		return arr
+	case *[]interface{}:
+		return copyValue(*v)
+	}
+	return val
+}
+
 // applyDefault fills missing fields.
+// "*" applies its spec to every key or array element, and "[N]" keys (or plain
+// numeric keys) address array indices. Named keys are handled before "*" so a
+// specific default wins over a wildcard one.
 func (e *Engine) applyDefault(input interface{}, spec interface{}) (interface{}, error) {
 	specMap, ok := spec.(map[string]interface{})
 	if !ok {
 		return input, nil
 	}
+	return e.processDefault(input, specMap), nil
+}
 
-	inputMap, ok := input.(map[string]interface{})
-	if !ok {
-		return input, nil
-	}
-
-	// Sort keys.
-	keys := make([]string, 0, len(specMap))
-	for k := range specMap {
-		keys = append(keys, k)
+func (e *Engine) processDefault(input interface{}, spec map[string]interface{}) interface{} {
+	// Sort keys, wildcard last.
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		if k != "*" {
+			keys = append(keys, k)
+		}
 	}
 	sort.Strings(keys)
-
-	for _, key := range keys {
-		defaultVal := specMap[key]
-		if _, exists := inputMap[key]; !exists {
-			inputMap[key] = defaultVal
-		} else if nestedSpec, ok := defaultVal.(map[string]interface{}); ok {
-			// Recurse.
-			if nestedInput, ok := inputMap[key].(map[string]interface{}); ok {
-				res, _ := e.applyDefault(nestedInput, nestedSpec)
-				inputMap[key] = res
-			}
-		}
+	if _, ok := spec["*"]; ok {
+		keys = append(keys, "*")
 	}
 
-	return inputMap, nil
-}
-
-// Regex patterns for function parsing.
-var (
-	concatPattern = regexp.MustCompile(`@concat\(([^)]*)\)`)
-	lookupPattern = regexp.MustCompile(`@lookup\(([^,]+),\s*'([^']*)',\s*'([^']*)'\)`)
-)
+	switch in := input.(type) {
+	case map[string]interface{}:
+		for _, key := range keys {
+			defaultVal := spec[key]
+			nestedSpec, descend := defaultVal.(map[string]interface{})
+
+			if key == "*" {
+				if descend {
+					for k, val := range in {
+						in[k] = e.processDefault(val, nestedSpec)
+					}
+				}
+				continue
+			}
 
-// evaluateFunction checks if a spec value is a function and evaluates it.
-// Returns the original value if not a function.
-// evaluateFunction checks if a spec value is a function and evaluates it.
-// Returns the original value if not a function.
-func (e *Engine) evaluateFunction(spec string, input interface{}) interface{} {
-	// Handle @concat
-	spec = concatPattern.ReplaceAllStringFunc(spec, func(match string) string {
-		sub := concatPattern.FindStringSubmatch(match)
-		if len(sub) > 1 {
-			res := e.evaluateConcat(sub[1], input)
-			if res != nil {
-				return fmt.Sprintf("%v", res)
+			if _, exists := in[key]; !exists {
+				in[key] = copyValue(defaultVal)
+			} else if descend {
+				in[key] = e.processDefault(in[key], nestedSpec)
 			}
 		}
-		return match // Keep original if evaluation fails
-	})
+		return in
 
-	// Handle @lookup
-	spec = lookupPattern.ReplaceAllStringFunc(spec, func(match string) string {
-		sub := lookupPattern.FindStringSubmatch(match)
-		if len(sub) > 3 {
-			res := e.evaluateLookup(sub[1], sub[2], sub[3], input)
-			if res != nil {
-				return fmt.Sprintf("%v", res)
+	case []interface{}:
+		for _, key := range keys {
+			defaultVal := spec[key]
+			nestedSpec, descend := defaultVal.(map[string]interface{})
+
+			var matched []int
+			if key == "*" {
+				for i := range in {
+					matched = append(matched, i)
+				}
+			} else if idx, ok := parseIndexKey(key); ok && idx < len(in) {
+				matched = append(matched, idx)
+			}
+
+			for _, i := range matched {
+				if in[i] == nil && key != "*" {
+					in[i] = copyValue(defaultVal)
+				} else if descend {
+					in[i] = e.processDefault(in[i], nestedSpec)
+				}
 			}
 		}
-		return match
-	})
+		return in
+	}
 
-	return spec
+	return input
 }
 
-// evaluateConcat joins multiple fields with separators.
-// Args format: field1, ' ', field2, '-', field3
-func (e *Engine) evaluateConcat(args string, input interface{}) interface{} {
-	inputMap, ok := input.(map[string]interface{})
-	if !ok {
-		return nil
+// parseIndexKey reads an array index spec key, either "[N]" or "N".
+func parseIndexKey(key string) (int, bool) {
+	if strings.HasPrefix(key, "[") && strings.HasSuffix(key, "]") {
+		key = key[1 : len(key)-1]
+	}
+	idx, err := strconv.Atoi(key)
+	if err != nil || idx < 0 {
+		return 0, false
 	}
+	return idx, true
+}
 
-	var result strings.Builder
-	parts := strings.Split(args, ",")
+// expandFunctions evaluates the "@name(...)" calls embedded in an output
+// path, such as "byName.@concat(first, '_', last)", and splices their results
+// in as text. Calls use the expression language of modify specs: fields
+// resolve against the matched value and "@(N,path)" walks up the input. ok is
+// false when a call yields null, in which case the value is not placed.
+func (e *Engine) expandFunctions(path string, output *shiftOutput, stack []shiftLevel) (string, bool, error) {
+	if !strings.Contains(path, "@") {
+		return path, true, nil
+	}
 
-	for _, part := range parts {
-		part = strings.TrimSpace(part)
+	var env *expr.Env
+	var sb strings.Builder
+	for i := 0; i < len(path); i++ {
+		end, isCall, err := callEnd(path, i)
+		if err != nil {
+			return "", false, fmt.Errorf("output path %q: %w", path, err)
+		}
+		if !isCall {
+			sb.WriteByte(path[i])
+			continue
+		}
 
-		// Check if it's a literal string (quoted)
-		if len(part) >= 2 && part[0] == '\'' && part[len(part)-1] == '\'' {
-			result.WriteString(part[1 : len(part)-1])
-		} else {
-			// It's a field reference - look it up in input
-			val := e.getNestedValue(inputMap, part)
-			if val != nil {
-				switch v := val.(type) {
-				case string:
-					result.WriteString(v)
-				case []interface{}:
-					// Join array elements with space
-					for i, item := range v {
-						if i > 0 {
-							result.WriteString(" ")
-						}
-						if s, ok := item.(string); ok {
-							result.WriteString(s)
-						}
-					}
-				default:
-					result.WriteString(fmt.Sprintf("%v", v))
-				}
+		x, err := output.compile(path[i+1 : end])
+		if err != nil {
+			var se *expr.SyntaxError
+			if errors.As(err, &se) {
+				// Report the position within the whole path.
+				err = &expr.SyntaxError{Pos: se.Pos + i + 1, Msg: se.Msg}
 			}
+			return "", false, fmt.Errorf("output path %q: %w", path, err)
 		}
-	}
 
-	return result.String()
+		if env == nil {
+			env = &expr.Env{Stack: make([]interface{}, len(stack)), Fields: stack[len(stack)-1].value}
+			for j, level := range stack {
+				env.Stack[j] = level.value
+			}
+		}
+		res, err := x.Eval(env)
+		if err != nil {
+			return "", false, fmt.Errorf("output path %q: %w", path, err)
+		}
+		if res == nil {
+			return "", false, nil
+		}
+		sb.WriteString(valueKey(res))
+		i = end - 1
+	}
+	return sb.String(), true, nil
 }
 
-// evaluateLookup performs a key-value lookup.
-// @lookup(field, 'key', 'value') -> if input[field] == 'key', return 'value'
-func (e *Engine) evaluateLookup(field, key, value string, input interface{}) interface{} {
-	inputMap, ok := input.(map[string]interface{})
-	if !ok {
-		return nil
+// callEnd reports whether path[i] starts an "@name(...)" call and, if so, the
+// index just past its closing parenthesis. Quoted arguments may contain
+// parentheses.
+func callEnd(path string, i int) (int, bool, error) {
+	if path[i] != '@' {
+		return 0, false, nil
 	}
-
-	field = strings.TrimSpace(field)
-	fieldVal := e.getNestedValue(inputMap, field)
-	if fieldVal == nil {
-		return nil
+	j := i + 1
+	for j < len(path) && isNameByte(path[j], j == i+1) {
+		j++
 	}
-
-	// Check if field value matches the key
-	fieldStr := fmt.Sprintf("%v", fieldVal)
-	if fieldStr == key {
-		return value
+	if j == i+1 || j >= len(path) || path[j] != '(' {
+		return 0, false, nil
 	}
 
-	return fieldVal // Return original value if no match
-}
-
-// getNestedValue retrieves a value from a nested map using dot notation.
-func (e *Engine) getNestedValue(data map[string]interface{}, path string) interface{} {
-	parts := strings.Split(path, ".")
-	var current interface{} = data
-
-	for _, part := range parts {
-		if m, ok := current.(map[string]interface{}); ok {
-			current = m[part]
-		} else if arr, ok := current.([]interface{}); ok {
-			// Try to parse as array index
-			if idx, err := strconv.Atoi(part); err == nil && idx >= 0 && idx < len(arr) {
-				current = arr[idx]
-			} else {
-				return nil
+	depth := 0
+	for ; j < len(path); j++ {
+		switch c := path[j]; c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return j + 1, true, nil
+			}
+		case '\'', '"':
+			// Skip to the closing quote, honoring escapes.
+			for j++; j < len(path) && path[j] != c; j++ {
+				if path[j] == '\\' {
+					j++
+				}
 			}
-		} else {
-			return nil
 		}
 	}
+	return 0, false, &expr.SyntaxError{Pos: i, Msg: "unterminated function call"}
+}
+
+func isNameByte(c byte, first bool) bool {
+	if c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+		return true
+	}
+	return !first && c >= '0' && c <= '9'
+}
 
-	return current
+// compile parses a call once per shift.
+func (o *shiftOutput) compile(src string) (*expr.Expr, error) {
+	if x, ok := o.exprs[src]; ok {
+		return x, nil
+	}
+	x, err := expr.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	o.exprs[src] = x
+	return x, nil
 }
@@ -0,0 +1,70 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iammehrabsandhu/jmap/internal/expr"
+)
+
+// applyFilter keeps only the array elements matching a predicate.
+// The spec maps array paths (with "*" wildcards) to expressions evaluated
+// against each element, e.g. {"users": "active && age >= 18"}. Bare names
+// read the element's fields, "@" is the element itself and "@(N,path)"
+// climbs through the containers above it.
+func (e *Engine) applyFilter(input interface{}, spec interface{}) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid filter spec: expected map, got %T", spec)
+	}
+
+	// Sort paths for deterministic output.
+	paths := make([]string, 0, len(specMap))
+	for p := range specMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	current := input
+	for _, path := range paths {
+		src, ok := specMap[path].(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid filter for %s: expected expression string, got %T", path, specMap[path])
+		}
+		predicate, err := expr.Parse(src)
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", path, err)
+		}
+
+		current, err = e.updatePath(current, path, func(val interface{}, at pathMatch) (interface{}, error) {
+			arr, ok := val.([]interface{})
+			if !ok {
+				return val, nil
+			}
+			return filterArray(arr, predicate, append(at.parents, arr))
+		})
+		if err != nil {
+			return nil, fmt.Errorf("filter %s: %w", path, err)
+		}
+	}
+
+	return current, nil
+}
+
+// filterArray returns the elements of arr for which predicate is truthy.
+func filterArray(arr []interface{}, predicate *expr.Expr, stack []interface{}) ([]interface{}, error) {
+	kept := make([]interface{}, 0, len(arr))
+	for i, item := range arr {
+		res, err := predicate.Eval(&expr.Env{
+			Stack:  append(stack[:len(stack):len(stack)], item),
+			Fields: item,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		if expr.Truthy(res) {
+			kept = append(kept, item)
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,200 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// flattenConfig controls how nested paths are spelled as flat keys.
+type flattenConfig struct {
+	// path selects the sub-tree to convert (with "*" wildcards); empty is the
+	// whole document.
+	path string
+	// separator joins object keys, "." by default.
+	separator string
+	// indexArrays writes array indices as plain segments ("b.0") instead of
+	// brackets ("b[0]").
+	indexArrays bool
+}
+
+// applyFlatten turns nested objects into a single object with one key per
+// leaf: {"a": {"b": [{"c": 1}]}} becomes {"a.b[0].c": 1}. Empty objects and
+// arrays are kept as leaves so unflatten can restore them.
+func (e *Engine) applyFlatten(input interface{}, spec interface{}) (interface{}, error) {
+	cfg, err := parseFlattenConfig(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flatten spec: %w", err)
+	}
+
+	return e.updatePath(input, cfg.path, func(val interface{}, _ pathMatch) (interface{}, error) {
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+		default:
+			return val, nil
+		}
+
+		flat := make(map[string]interface{})
+		flattenInto(flat, val, "", cfg)
+		return flat, nil
+	})
+}
+
+// applyUnflatten is the inverse of applyFlatten: keys are split on the
+// separator and array notation, using the same path grammar as shift output
+// paths, and rebuilt into nested objects and arrays.
+func (e *Engine) applyUnflatten(input interface{}, spec interface{}) (interface{}, error) {
+	cfg, err := parseFlattenConfig(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid unflatten spec: %w", err)
+	}
+
+	return e.updatePath(input, cfg.path, func(val interface{}, _ pathMatch) (interface{}, error) {
+		flat, ok := val.(map[string]interface{})
+		if !ok {
+			return val, nil
+		}
+
+		// Sort keys so arrays grow in a deterministic order.
+		keys := make([]string, 0, len(flat))
+		for k := range flat {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		var nested interface{} = make(map[string]interface{})
+		for _, key := range keys {
+			segments := splitFlatKey(key, cfg)
+			if len(segments) == 0 {
+				continue
+			}
+			if err := checkFlatIndices(key, segments, len(flat)); err != nil {
+				return nil, err
+			}
+			nested = setSegments(nested, segments, flat[key])
+		}
+		return nested, nil
+	})
+}
+
+// checkFlatIndices rejects array indices that flatten could not have written.
+// Every element of a flattened array leaves at least one key, so an index is
+// never as large as the number of keys; a larger one would allocate an array
+// of that size from a single untrusted key.
+func checkFlatIndices(key string, segments []string, keys int) error {
+	for _, seg := range segments {
+		if !strings.HasPrefix(seg, "[") {
+			continue
+		}
+		if idx, err := strconv.Atoi(seg[1 : len(seg)-1]); err == nil && idx >= keys {
+			return fmt.Errorf("key %q: array index %d out of range for %d keys", key, idx, keys)
+		}
+	}
+	return nil
+}
+
+func parseFlattenConfig(spec interface{}) (flattenConfig, error) {
+	cfg := flattenConfig{separator: "."}
+	if spec == nil {
+		return cfg, nil
+	}
+
+	m, ok := spec.(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("expected map, got %T", spec)
+	}
+	if err := checkKeys(m, "path", "separator", "arrays"); err != nil {
+		return cfg, err
+	}
+
+	if path, ok := m["path"].(string); ok {
+		cfg.path = path
+	}
+	if sep, ok := m["separator"].(string); ok {
+		if sep == "" {
+			return cfg, fmt.Errorf("separator cannot be empty")
+		}
+		cfg.separator = sep
+	}
+
+	switch arrays := m["arrays"]; arrays {
+	case nil, "brackets":
+	case "index":
+		cfg.indexArrays = true
+	default:
+		return cfg, fmt.Errorf("unknown array notation %v: expected brackets or index", arrays)
+	}
+
+	return cfg, nil
+}
+
+func flattenInto(flat map[string]interface{}, val interface{}, prefix string, cfg flattenConfig) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		if len(v) == 0 && prefix != "" {
+			flat[prefix] = v
+			return
+		}
+		for k, item := range v {
+			key := k
+			if prefix != "" {
+				key = prefix + cfg.separator + k
+			}
+			flattenInto(flat, item, key, cfg)
+		}
+
+	case []interface{}:
+		if len(v) == 0 && prefix != "" {
+			flat[prefix] = v
+			return
+		}
+		for i, item := range v {
+			var key string
+			switch {
+			case cfg.indexArrays && prefix != "":
+				key = prefix + cfg.separator + strconv.Itoa(i)
+			case cfg.indexArrays:
+				key = strconv.Itoa(i)
+			default:
+				key = fmt.Sprintf("%s[%d]", prefix, i)
+			}
+			flattenInto(flat, item, key, cfg)
+		}
+
+	default:
+		flat[prefix] = val
+	}
+}
+
+// splitFlatKey splits "a.b[0].c" into parsePath-style segments.
+func splitFlatKey(key string, cfg flattenConfig) []string {
+	var segments []string
+	for _, part := range strings.Split(key, cfg.separator) {
+		// Peel "[N]" suffixes off each part: "b[0][1]" -> b, [0], [1].
+		name := part
+		var indices []string
+		if !cfg.indexArrays {
+			for strings.HasSuffix(name, "]") {
+				open := strings.LastIndex(name, "[")
+				if open < 0 {
+					break
+				}
+				if _, err := strconv.Atoi(name[open+1 : len(name)-1]); err != nil {
+					break
+				}
+				indices = append([]string{name[open:]}, indices...)
+				name = name[:open]
+			}
+		} else if _, err := strconv.Atoi(name); err == nil {
+			segments = append(segments, "["+name+"]")
+			continue
+		}
+
+		if name != "" {
+			segments = append(segments, name)
+		}
+		segments = append(segments, indices...)
+	}
+	return segments
+}
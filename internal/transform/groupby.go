@@ -0,0 +1,149 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iammehrabsandhu/jmap/internal/expr"
+)
+
+// groupByConfig describes how one array is pivoted.
+type groupByConfig struct {
+	// by computes each element's group key.
+	by *expr.Expr
+	// onCollision is "collect", "first", "last" or "error".
+	onCollision string
+	// target is where the groups go, relative to the object holding the
+	// array. Empty replaces the array itself.
+	target string
+}
+
+// applyGroupBy pivots arrays into objects keyed by an expression.
+// The spec maps array paths (with "*" wildcards) to
+// {"by": "accountId", "onCollision": "collect", "target": "byAccount"}.
+// "collect" (the default) gathers every element sharing a key into a list;
+// "first", "last" and "error" keep a single element per key and decide what
+// happens when a key repeats.
+func (e *Engine) applyGroupBy(input interface{}, spec interface{}) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid groupBy spec: expected map, got %T", spec)
+	}
+
+	// Sort paths for deterministic output.
+	paths := make([]string, 0, len(specMap))
+	for p := range specMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	current := input
+	for _, path := range paths {
+		cfg, err := parseGroupByConfig(specMap[path])
+		if err != nil {
+			return nil, fmt.Errorf("groupBy %s: %w", path, err)
+		}
+
+		current, err = e.updatePath(current, path, func(val interface{}, at pathMatch) (interface{}, error) {
+			arr, ok := val.([]interface{})
+			if !ok {
+				return val, nil
+			}
+
+			groups, err := groupArray(arr, cfg, append(at.parents, arr))
+			if err != nil {
+				return nil, err
+			}
+			if cfg.target == "" {
+				return groups, nil
+			}
+
+			if len(at.parents) == 0 {
+				return nil, fmt.Errorf("target %q needs an object holding the array", cfg.target)
+			}
+			holder, ok := at.parents[len(at.parents)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("target %q needs an object holding the array, got %T", cfg.target, at.parents[len(at.parents)-1])
+			}
+			setPath(holder, cfg.target, groups)
+			return arr, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("groupBy %s: %w", path, err)
+		}
+	}
+
+	return current, nil
+}
+
+func parseGroupByConfig(raw interface{}) (groupByConfig, error) {
+	cfg := groupByConfig{onCollision: "collect"}
+
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("expected map, got %T", raw)
+	}
+	if err := checkKeys(m, "by", "onCollision", "target"); err != nil {
+		return cfg, err
+	}
+
+	by, ok := m["by"].(string)
+	if !ok || by == "" {
+		return cfg, fmt.Errorf("missing key expression \"by\"")
+	}
+	x, err := expr.Parse(by)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.by = x
+
+	switch policy := m["onCollision"]; policy {
+	case nil:
+	case "collect", "first", "last", "error":
+		cfg.onCollision = policy.(string)
+	default:
+		return cfg, fmt.Errorf("unknown collision policy %v", policy)
+	}
+
+	if target, ok := m["target"].(string); ok {
+		cfg.target = target
+	}
+
+	return cfg, nil
+}
+
+// groupArray buckets elements by key. stack ends with the array itself.
+func groupArray(arr []interface{}, cfg groupByConfig, stack []interface{}) (map[string]interface{}, error) {
+	groups := make(map[string]interface{})
+
+	for i, item := range arr {
+		keyVal, err := cfg.by.Eval(&expr.Env{
+			Stack:  append(stack[:len(stack):len(stack)], item),
+			Fields: item,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("[%d]: %w", i, err)
+		}
+		key := valueKey(keyVal)
+
+		existing, exists := groups[key]
+		switch cfg.onCollision {
+		case "collect":
+			list, _ := existing.([]interface{})
+			groups[key] = append(list, item)
+		case "first":
+			if !exists {
+				groups[key] = item
+			}
+		case "last":
+			groups[key] = item
+		case "error":
+			if exists {
+				return nil, fmt.Errorf("[%d]: duplicate group key %q", i, key)
+			}
+			groups[key] = item
+		}
+	}
+
+	return groups, nil
+}
@@ -0,0 +1,234 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// mergeConfig describes one merge operation.
+type mergeConfig struct {
+	target string
+	// from lists source paths merged in order; value is a literal source.
+	from  []string
+	value interface{}
+	// arrays is "replace", "concat", "index" or "key".
+	arrays string
+	// key is the element field "key" array merges match on.
+	key string
+	// onConflict is "overwrite", "keep" or "error".
+	onConflict string
+}
+
+// applyMerge deep-merges a literal object or sub-trees of the document into
+// a target path:
+// {"target": "address", "from": ["billing", "shipping"], "arrays": "key", "key": "type"}.
+// Objects merge key by key. Arrays are replaced, concatenated, merged by
+// index or merged by matching a key field. Conflicting scalars follow
+// onConflict; a null source value never overrides anything.
+func (e *Engine) applyMerge(input interface{}, spec interface{}) (interface{}, error) {
+	cfg, err := parseMergeConfig(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid merge spec: %w", err)
+	}
+
+	var sources []interface{}
+	if cfg.value != nil {
+		sources = append(sources, cfg.value)
+	}
+	for _, from := range cfg.from {
+		if src, found := lookupPath(input, from); found {
+			sources = append(sources, src)
+		}
+	}
+
+	// Without a source there is nothing to merge, and a missing target is
+	// not created empty.
+	found := false
+	for _, src := range sources {
+		found = found || src != nil
+	}
+	if !found {
+		return input, nil
+	}
+
+	// A missing target is created, unless it is a wildcard path with nothing
+	// to match.
+	if !strings.Contains(cfg.target, "*") {
+		if _, found := lookupPath(input, cfg.target); !found {
+			input = setPath(input, cfg.target, nil)
+		}
+	}
+
+	return e.updatePath(input, cfg.target, func(val interface{}, _ pathMatch) (interface{}, error) {
+		merged := val
+		for _, src := range sources {
+			var err error
+			if merged, err = mergeValues(merged, src, cfg, cfg.target); err != nil {
+				return nil, err
+			}
+		}
+		return merged, nil
+	})
+}
+
+func parseMergeConfig(spec interface{}) (mergeConfig, error) {
+	cfg := mergeConfig{arrays: "replace", onConflict: "overwrite"}
+
+	m, ok := spec.(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("expected map, got %T", spec)
+	}
+	if err := checkKeys(m, "target", "from", "value", "arrays", "key", "onConflict"); err != nil {
+		return cfg, err
+	}
+
+	cfg.target, _ = m["target"].(string)
+	if cfg.target == "" {
+		return cfg, fmt.Errorf("needs a \"target\" path")
+	}
+
+	switch from := m["from"].(type) {
+	case nil:
+	case string:
+		cfg.from = []string{from}
+	case []interface{}:
+		for _, item := range from {
+			path, ok := item.(string)
+			if !ok {
+				return cfg, fmt.Errorf("from entries must be paths, got %T", item)
+			}
+			cfg.from = append(cfg.from, path)
+		}
+	default:
+		return cfg, fmt.Errorf("from must be a path or list of paths, got %T", from)
+	}
+
+	cfg.value = m["value"]
+	if cfg.value == nil && len(cfg.from) == 0 {
+		return cfg, fmt.Errorf("needs \"from\" or \"value\"")
+	}
+
+	switch arrays := m["arrays"]; arrays {
+	case nil:
+	case "replace", "concat", "index", "key":
+		cfg.arrays = arrays.(string)
+	default:
+		return cfg, fmt.Errorf("unknown array strategy %v", arrays)
+	}
+
+	cfg.key, _ = m["key"].(string)
+	if cfg.arrays == "key" && cfg.key == "" {
+		return cfg, fmt.Errorf("array strategy \"key\" needs a \"key\" field")
+	}
+
+	switch policy := m["onConflict"]; policy {
+	case nil:
+	case "overwrite", "keep", "error":
+		cfg.onConflict = policy.(string)
+	default:
+		return cfg, fmt.Errorf("unknown conflict policy %v", policy)
+	}
+
+	return cfg, nil
+}
+
+// mergeValues merges src into dst and returns the result. path is only used
+// in error messages.
+func mergeValues(dst, src interface{}, cfg mergeConfig, path string) (interface{}, error) {
+	if src == nil {
+		return dst, nil
+	}
+	if dst == nil {
+		return copyValue(src), nil
+	}
+
+	switch d := dst.(type) {
+	case map[string]interface{}:
+		if s, ok := src.(map[string]interface{}); ok {
+			for k, sv := range s {
+				childPath := k
+				if path != "" {
+					childPath = path + "." + k
+				}
+				merged, err := mergeValues(d[k], sv, cfg, childPath)
+				if err != nil {
+					return nil, err
+				}
+				if merged != nil {
+					d[k] = merged
+				}
+			}
+			return d, nil
+		}
+
+	case []interface{}:
+		if s, ok := src.([]interface{}); ok {
+			return mergeArrays(d, s, cfg, path)
+		}
+	}
+
+	if reflect.DeepEqual(dst, src) {
+		return dst, nil
+	}
+
+	switch cfg.onConflict {
+	case "keep":
+		return dst, nil
+	case "error":
+		return nil, fmt.Errorf("merge conflict at %s: %v vs %v", path, dst, src)
+	}
+	return copyValue(src), nil
+}
+
+func mergeArrays(dst, src []interface{}, cfg mergeConfig, path string) (interface{}, error) {
+	switch cfg.arrays {
+	case "concat":
+		return append(dst, copyValue(src).([]interface{})...), nil
+
+	case "index":
+		for i, sv := range src {
+			if i >= len(dst) {
+				dst = append(dst, copyValue(sv))
+				continue
+			}
+			merged, err := mergeValues(dst[i], sv, cfg, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			dst[i] = merged
+		}
+		return dst, nil
+
+	case "key":
+		// Elements without the key field are appended as-is.
+		for _, sv := range src {
+			sm, ok := sv.(map[string]interface{})
+			if !ok || sm[cfg.key] == nil {
+				dst = append(dst, copyValue(sv))
+				continue
+			}
+
+			matched := false
+			for i, dv := range dst {
+				dm, ok := dv.(map[string]interface{})
+				if !ok || !reflect.DeepEqual(dm[cfg.key], sm[cfg.key]) {
+					continue
+				}
+				merged, err := mergeValues(dm, sm, cfg, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				dst[i] = merged
+				matched = true
+				break
+			}
+			if !matched {
+				dst = append(dst, copyValue(sv))
+			}
+		}
+		return dst, nil
+	}
+
+	return copyValue(src), nil
+}
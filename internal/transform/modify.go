@@ -0,0 +1,163 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iammehrabsandhu/jmap/internal/expr"
+)
+
+// applyModify computes values in place.
+// The spec mirrors the input tree like default, with "*" matching every
+// existing key or element and numeric keys addressing array indices. Leaf
+// strings starting with "=" are expressions evaluated against the enclosing
+// object, e.g. "=concat(given, ' ', @(1,family))"; other leaves are literals.
+// modify-overwrite always writes, modify-default only fills missing or null keys.
+func (e *Engine) applyModify(input interface{}, spec interface{}, overwrite bool) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid modify spec: expected map, got %T", spec)
+	}
+
+	pass := &modifyPass{overwrite: overwrite, exprs: make(map[string]*expr.Expr)}
+	if _, err := e.processModify(input, specMap, []interface{}{input}, pass); err != nil {
+		return nil, err
+	}
+	return input, nil
+}
+
+// modifyPass is the state of one modify operation.
+type modifyPass struct {
+	// overwrite distinguishes modify-overwrite from modify-default.
+	overwrite bool
+	// exprs caches parsed expressions by source, since a leaf under "*" is
+	// evaluated once per matched element.
+	exprs map[string]*expr.Expr
+}
+
+// compile parses an expression once per operation.
+func (p *modifyPass) compile(src string) (*expr.Expr, error) {
+	if x, ok := p.exprs[src]; ok {
+		return x, nil
+	}
+	x, err := expr.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	p.exprs[src] = x
+	return x, nil
+}
+
+// processModify walks one container and reports whether it wrote anything.
+// stack holds every container from the root down to this one, which is what
+// "@(N,path)" references climb.
+func (e *Engine) processModify(container interface{}, spec map[string]interface{}, stack []interface{}, pass *modifyPass) (bool, error) {
+	// Sort keys for deterministic output.
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	wrote := false
+	for _, key := range keys {
+		specVal := spec[key]
+
+		switch c := container.(type) {
+		case map[string]interface{}:
+			matched := []string{key}
+			if key == "*" {
+				matched = make([]string, 0, len(c))
+				for k := range c {
+					matched = append(matched, k)
+				}
+				sort.Strings(matched)
+			}
+
+			for _, k := range matched {
+				val, exists := c[k]
+				res, write, err := e.modifyField(val, exists, specVal, c, stack, pass)
+				if err != nil {
+					return false, fmt.Errorf("%s: %w", k, err)
+				}
+				if write {
+					c[k] = res
+					wrote = true
+				}
+			}
+
+		case []interface{}:
+			var matched []int
+			if key == "*" {
+				for i := range c {
+					matched = append(matched, i)
+				}
+			} else if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(c) {
+				matched = append(matched, idx)
+			}
+
+			for _, i := range matched {
+				res, write, err := e.modifyField(c[i], true, specVal, c, stack, pass)
+				if err != nil {
+					return false, fmt.Errorf("[%d]: %w", i, err)
+				}
+				if write {
+					c[i] = res
+					wrote = true
+				}
+			}
+		}
+	}
+
+	return wrote, nil
+}
+
+// modifyField computes the new value for one key and whether to write it.
+func (e *Engine) modifyField(val interface{}, exists bool, specVal interface{}, container interface{}, stack []interface{}, pass *modifyPass) (interface{}, bool, error) {
+	if nestedSpec, ok := specVal.(map[string]interface{}); ok {
+		created := !exists || val == nil
+		if created {
+			val = make(map[string]interface{})
+		}
+		switch val.(type) {
+		case map[string]interface{}, []interface{}:
+			wrote, err := e.processModify(val, nestedSpec, append(stack[:len(stack):len(stack)], val), pass)
+			if err != nil {
+				return nil, false, err
+			}
+			// A container created here is only kept if something went in.
+			return val, wrote || !created, nil
+		}
+		return val, false, nil
+	}
+
+	if !pass.overwrite && exists && val != nil {
+		return val, false, nil
+	}
+
+	str, ok := specVal.(string)
+	if !ok || !strings.HasPrefix(str, "=") {
+		return copyValue(specVal), true, nil
+	}
+
+	x, err := pass.compile(str[1:])
+	if err != nil {
+		return nil, false, err
+	}
+
+	res, err := x.Eval(&expr.Env{
+		Stack:  append(stack[:len(stack):len(stack)], val),
+		Fields: container,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Nothing computed: leave the key as it was.
+	if res == nil {
+		return val, false, nil
+	}
+	return res, true, nil
+}
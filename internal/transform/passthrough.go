@@ -0,0 +1,141 @@
+package transform
+
+import (
+	"strconv"
+	"strings"
+)
+
+// childPath extends an input path by one key. Values outside the input walk
+// (nil path) have no children to track.
+func childPath(parent []string, key string) []string {
+	if parent == nil {
+		return nil
+	}
+	path := make([]string, len(parent), len(parent)+1)
+	copy(path, parent)
+	return append(path, key)
+}
+
+// consumedKey spells an input path as a map key. Segments are joined with a
+// byte that cannot appear in JSON text unescaped, so dotted keys stay intact.
+func consumedKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// consume records that the input value at path was written to the output.
+func (o *shiftOutput) consume(path []string) {
+	if o.consumed == nil || path == nil {
+		return
+	}
+	o.consumed[consumedKey(path)] = true
+}
+
+// mappedElement holds the place of a fully mapped array element in the
+// unconsumed input, so the elements after it keep their positions without
+// the gap being mistaken for a null in the input.
+type mappedElement struct{}
+
+// unconsumed copies the parts of val the shift never wrote anywhere. It
+// reports false when nothing is left, so a container whose fields were all
+// mapped is not carried over as an empty shell. Array elements keep their
+// positions; fully mapped elements become mappedElement.
+func unconsumed(val interface{}, path []string, consumed map[string]bool) (interface{}, bool) {
+	if consumed[consumedKey(path)] {
+		return nil, false
+	}
+
+	switch v := val.(type) {
+	case map[string]interface{}:
+		rest := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			if r, ok := unconsumed(item, childPath(path, k), consumed); ok {
+				rest[k] = r
+			}
+		}
+		if len(v) > 0 && len(rest) == 0 {
+			return nil, false
+		}
+		return rest, true
+
+	case []interface{}:
+		rest := make([]interface{}, len(v))
+		kept := false
+		for i, item := range v {
+			rest[i] = mappedElement{}
+			if r, ok := unconsumed(item, childPath(path, strconv.Itoa(i)), consumed); ok {
+				rest[i] = r
+				kept = true
+			}
+		}
+		if len(v) > 0 && !kept {
+			return nil, false
+		}
+		return rest, true
+	}
+
+	return val, true
+}
+
+// mergePassthrough lays the unmatched input under the shift output. Values the
+// shift wrote always win; only missing keys and empty array slots are filled.
+// Fully mapped elements fill nothing, and are dropped where the output has no
+// element to keep their place.
+func mergePassthrough(out, rest interface{}) interface{} {
+	switch o := out.(type) {
+	case map[string]interface{}:
+		r, ok := rest.(map[string]interface{})
+		if !ok {
+			return out
+		}
+		for k, rv := range r {
+			if ov, exists := o[k]; exists {
+				o[k] = mergePassthrough(ov, rv)
+			} else {
+				o[k] = dropMapped(rv)
+			}
+		}
+		return o
+
+	case []interface{}:
+		r, ok := rest.([]interface{})
+		if !ok {
+			return out
+		}
+		for i, rv := range r {
+			if _, mapped := rv.(mappedElement); mapped {
+				continue
+			}
+			switch {
+			case i >= len(o):
+				o = append(o, dropMapped(rv))
+			case o[i] == nil:
+				o[i] = dropMapped(rv)
+			default:
+				o[i] = mergePassthrough(o[i], rv)
+			}
+		}
+		return o
+	}
+
+	return out
+}
+
+// dropMapped removes the mappedElement placeholders from unconsumed input that
+// is copied into the output as is.
+func dropMapped(rest interface{}) interface{} {
+	switch r := rest.(type) {
+	case map[string]interface{}:
+		for k, v := range r {
+			r[k] = dropMapped(v)
+		}
+	case []interface{}:
+		kept := r[:0]
+		for _, v := range r {
+			if _, mapped := v.(mappedElement); !mapped {
+				kept = append(kept, dropMapped(v))
+			}
+		}
+		return kept
+	}
+	return rest
+}
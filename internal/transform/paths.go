@@ -0,0 +1,192 @@
+package transform
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// pathMatch describes where updatePath found a value.
+type pathMatch struct {
+	// wildcards holds the keys matched by each "*" in the path, outermost first.
+	wildcards []string
+
+	// parents holds every container from the document root down to the one
+	// holding the value.
+	parents []interface{}
+}
+
+// pathVisitor computes the replacement for a value matched by updatePath.
+type pathVisitor func(val interface{}, at pathMatch) (interface{}, error)
+
+// updatePath replaces every value addressed by path with the result of fn.
+// Paths use the same grammar as placeValue ("a.b[0].c"), with "*" or "[*]"
+// matching every key or element. Missing paths are skipped and an empty path
+// addresses the document itself.
+func (e *Engine) updatePath(doc interface{}, path string, fn pathVisitor) (interface{}, error) {
+	return e.updateSegments(doc, parsePath(path), pathMatch{}, fn)
+}
+
+func (e *Engine) updateSegments(current interface{}, segments []string, at pathMatch, fn pathVisitor) (interface{}, error) {
+	if len(segments) == 0 {
+		return fn(current, at)
+	}
+
+	child := pathMatch{
+		wildcards: at.wildcards,
+		parents:   append(at.parents[:len(at.parents):len(at.parents)], current),
+	}
+
+	seg, rest := segments[0], segments[1:]
+	isWildcard := seg == "*" || seg == "[*]"
+
+	switch c := current.(type) {
+	case map[string]interface{}:
+		if isWildcard {
+			keys := make([]string, 0, len(c))
+			for k := range c {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				res, err := e.updateSegments(c[k], rest, child.withWildcard(k), fn)
+				if err != nil {
+					return nil, err
+				}
+				c[k] = res
+			}
+			return c, nil
+		}
+
+		key := strings.Trim(seg, "[]")
+		val, exists := c[key]
+		if !exists {
+			return c, nil
+		}
+		res, err := e.updateSegments(val, rest, child, fn)
+		if err != nil {
+			return nil, err
+		}
+		c[key] = res
+
+	case []interface{}:
+		if isWildcard {
+			for i := range c {
+				res, err := e.updateSegments(c[i], rest, child.withWildcard(strconv.Itoa(i)), fn)
+				if err != nil {
+					return nil, err
+				}
+				c[i] = res
+			}
+			return c, nil
+		}
+
+		idx, err := strconv.Atoi(strings.Trim(seg, "[]"))
+		if err != nil {
+			return c, nil
+		}
+		if idx < 0 {
+			idx += len(c)
+		}
+		if idx < 0 || idx >= len(c) {
+			return c, nil
+		}
+		res, err := e.updateSegments(c[idx], rest, child, fn)
+		if err != nil {
+			return nil, err
+		}
+		c[idx] = res
+	}
+
+	return current, nil
+}
+
+// lookupPath reads the value at path inside val, reporting whether it exists.
+// An empty path returns val itself.
+func lookupPath(val interface{}, path string) (interface{}, bool) {
+	current := val
+	for _, seg := range parsePath(path) {
+		key := strings.Trim(seg, "[]")
+		switch c := current.(type) {
+		case map[string]interface{}:
+			next, exists := c[key]
+			if !exists {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			idx, err := strconv.Atoi(key)
+			if err != nil || idx < 0 || idx >= len(c) {
+				return nil, false
+			}
+			current = c[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// withWildcard records the key a "*" matched, without sharing the backing
+// array between siblings.
+func (m pathMatch) withWildcard(key string) pathMatch {
+	wildcards := make([]string, len(m.wildcards), len(m.wildcards)+1)
+	copy(wildcards, m.wildcards)
+	m.wildcards = append(wildcards, key)
+	return m
+}
+
+// setPath writes val at path inside doc, creating objects and arrays on the
+// way, and returns the updated document. "[]" appends to an array.
+func setPath(doc interface{}, path string, val interface{}) interface{} {
+	return setSegments(doc, parsePath(path), val)
+}
+
+func setSegments(current interface{}, segments []string, val interface{}) interface{} {
+	if len(segments) == 0 {
+		return val
+	}
+	seg, rest := segments[0], segments[1:]
+
+	if strings.HasPrefix(seg, "[") && strings.HasSuffix(seg, "]") && seg != "[*]" {
+		arr, _ := current.([]interface{})
+
+		idx := len(arr)
+		if seg != "[]" {
+			n, err := strconv.Atoi(seg[1 : len(seg)-1])
+			if err != nil || n < 0 {
+				return current
+			}
+			idx = n
+		}
+
+		// Grow if needed
+		if idx >= len(arr) {
+			grown := make([]interface{}, idx+1)
+			copy(grown, arr)
+			arr = grown
+		}
+		arr[idx] = setSegments(arr[idx], rest, val)
+		return arr
+	}
+
+	m, ok := current.(map[string]interface{})
+	if !ok {
+		m = make(map[string]interface{})
+	}
+	m[seg] = setSegments(m[seg], rest, val)
+	return m
+}
+
+// joinPath is the inverse of parsePath.
+func joinPath(segments []string) string {
+	var sb strings.Builder
+	for i, seg := range segments {
+		if i > 0 && !strings.HasPrefix(seg, "[") {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(seg)
+	}
+	return sb.String()
+}
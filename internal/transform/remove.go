@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// applyRemove deletes the paths mirrored by the spec.
+// A leaf spec value (conventionally "") removes the matched key, a nested map
+// descends into it. "*" matches every key or element and numeric keys address
+// array indices, same as in shift specs.
+func (e *Engine) applyRemove(input interface{}, spec interface{}) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid remove spec: expected map, got %T", spec)
+	}
+	return e.processRemove(input, specMap), nil
+}
+
+func (e *Engine) processRemove(input interface{}, spec map[string]interface{}) interface{} {
+	// Sort keys for deterministic output.
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	switch in := input.(type) {
+	case map[string]interface{}:
+		for _, key := range keys {
+			nestedSpec, descend := spec[key].(map[string]interface{})
+
+			matched := []string{key}
+			if key == "*" {
+				matched = make([]string, 0, len(in))
+				for k := range in {
+					matched = append(matched, k)
+				}
+			}
+
+			for _, k := range matched {
+				val, exists := in[k]
+				if !exists {
+					continue
+				}
+				if descend {
+					in[k] = e.processRemove(val, nestedSpec)
+				} else {
+					delete(in, k)
+				}
+			}
+		}
+		return in
+
+	case []interface{}:
+		drop := make(map[int]bool)
+		for _, key := range keys {
+			nestedSpec, descend := spec[key].(map[string]interface{})
+
+			var matched []int
+			if key == "*" {
+				for i := range in {
+					matched = append(matched, i)
+				}
+			} else if idx, err := strconv.Atoi(key); err == nil && idx >= 0 && idx < len(in) {
+				matched = append(matched, idx)
+			}
+
+			for _, i := range matched {
+				if descend {
+					in[i] = e.processRemove(in[i], nestedSpec)
+				} else {
+					drop[i] = true
+				}
+			}
+		}
+
+		if len(drop) == 0 {
+			return in
+		}
+
+		// Rebuild so indices are resolved against the original array.
+		kept := make([]interface{}, 0, len(in)-len(drop))
+		for i, item := range in {
+			if !drop[i] {
+				kept = append(kept, item)
+			}
+		}
+		return kept
+	}
+
+	return input
+}
@@ -0,0 +1,131 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// renameMatch is one key found under a rename source path.
+type renameMatch struct {
+	holder    map[string]interface{}
+	key       string
+	val       interface{}
+	wildcards []string
+}
+
+// applyRename moves values in place, leaving the rest of the document alone.
+// The spec maps old paths to new paths, both from the document root:
+// {"customer.addr": "customer.address"}. Each "*" or "[*]" in the new path is
+// replaced by the key the corresponding "*" in the old path matched, so
+// {"items[*].cost": "items[*].price"} renames the field in every element.
+// All entries move at once: {"a": "b", "b": "c"} moves a to b and b to c.
+// Missing old paths are skipped and an existing value at the new path is
+// overwritten.
+func (e *Engine) applyRename(input interface{}, spec interface{}) (interface{}, error) {
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid rename spec: expected map, got %T", spec)
+	}
+
+	// Sort paths for deterministic output.
+	paths := make([]string, 0, len(specMap))
+	for p := range specMap {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	// Collect the matches of every entry before moving any of them, so
+	// {"a": "b", "b": "c"} moves both values instead of renaming a onto b
+	// and then b onto c.
+	type pending struct {
+		from, to string
+		matches  []renameMatch
+	}
+	renames := make([]pending, 0, len(paths))
+	for _, from := range paths {
+		to, ok := specMap[from].(string)
+		if !ok || to == "" {
+			return nil, fmt.Errorf("rename %s: expected new path string, got %v", from, specMap[from])
+		}
+
+		matches, err := e.collectRenames(input, from)
+		if err != nil {
+			return nil, fmt.Errorf("rename %s: %w", from, err)
+		}
+		renames = append(renames, pending{from: from, to: to, matches: matches})
+	}
+
+	// Detach every match before writing so a rename cannot clobber a key
+	// that has yet to be moved.
+	for _, r := range renames {
+		for _, m := range r.matches {
+			delete(m.holder, m.key)
+		}
+	}
+
+	current := input
+	for _, r := range renames {
+		for _, m := range r.matches {
+			segments, err := substituteWildcards(parsePath(r.to), m.wildcards)
+			if err != nil {
+				return nil, fmt.Errorf("rename %s: %w", r.from, err)
+			}
+			current = setSegments(current, segments, m.val)
+		}
+	}
+
+	return current, nil
+}
+
+// collectRenames finds every object key addressed by path.
+func (e *Engine) collectRenames(doc interface{}, path string) ([]renameMatch, error) {
+	segments := parsePath(path)
+	if len(segments) == 0 {
+		return nil, fmt.Errorf("cannot rename the document root")
+	}
+	last := segments[len(segments)-1]
+
+	var matches []renameMatch
+	_, err := e.updatePath(doc, path, func(val interface{}, at pathMatch) (interface{}, error) {
+		holder, ok := at.parents[len(at.parents)-1].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("can only rename object keys, got %T", at.parents[len(at.parents)-1])
+		}
+
+		key := strings.Trim(last, "[]")
+		if last == "*" || last == "[*]" {
+			key = at.wildcards[len(at.wildcards)-1]
+		}
+		matches = append(matches, renameMatch{holder: holder, key: key, val: val, wildcards: at.wildcards})
+		return val, nil
+	})
+	return matches, err
+}
+
+// substituteWildcards replaces the "*" segments of a target path with the keys
+// matched by the source path, in order.
+func substituteWildcards(segments []string, wildcards []string) ([]string, error) {
+	out := make([]string, len(segments))
+	n := 0
+	for i, seg := range segments {
+		if seg != "*" && seg != "[*]" {
+			out[i] = seg
+			continue
+		}
+		if n >= len(wildcards) {
+			return nil, fmt.Errorf("new path has more wildcards than the old path")
+		}
+		if seg == "[*]" {
+			if _, err := strconv.Atoi(wildcards[n]); err != nil {
+				return nil, fmt.Errorf("key %q cannot be used as an array index", wildcards[n])
+			}
+			out[i] = "[" + wildcards[n] + "]"
+		} else {
+			out[i] = wildcards[n]
+		}
+		n++
+	}
+	return out, nil
+}
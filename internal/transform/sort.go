@@ -0,0 +1,203 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/iammehrabsandhu/jmap/internal/expr"
+)
+
+// sortConfig describes how one array is ordered.
+type sortConfig struct {
+	// By is a dot path inside each element; empty sorts the elements themselves.
+	By string
+	// Descending reverses the order.
+	Descending bool
+	// Compare is "auto", "number" or "string".
+	Compare string
+}
+
+// applySort orders array contents.
+// Objects need no work: encoding/json writes map keys in sorted order at every
+// depth, so the result is always key-sorted once marshalled. "keys": true
+// states that recursive key sort; any other value is rejected, since no other
+// key order can be written. Arrays are sorted per the "arrays" spec, which
+// maps array paths (with "*" wildcards) to
+// {"by": "field.path", "order": "asc"|"desc", "compare": "auto"|"number"|"string"}.
+func (e *Engine) applySort(input interface{}, spec interface{}) (interface{}, error) {
+	if spec == nil {
+		return input, nil
+	}
+
+	specMap, ok := spec.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid sort spec: expected map, got %T", spec)
+	}
+	if err := checkKeys(specMap, "arrays", "keys"); err != nil {
+		return nil, fmt.Errorf("invalid sort spec: %w", err)
+	}
+	if keys, exists := specMap["keys"]; exists && keys != true {
+		return nil, fmt.Errorf("invalid sort spec: keys must be true, got %v; object keys are always written in ascending order", keys)
+	}
+
+	arrays, ok := specMap["arrays"].(map[string]interface{})
+	if !ok {
+		if _, exists := specMap["arrays"]; exists {
+			return nil, fmt.Errorf("invalid sort spec: arrays must be a map, got %T", specMap["arrays"])
+		}
+		return input, nil
+	}
+
+	// Sort paths for deterministic output.
+	paths := make([]string, 0, len(arrays))
+	for p := range arrays {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	current := input
+	for _, path := range paths {
+		cfg, err := parseSortConfig(arrays[path])
+		if err != nil {
+			return nil, fmt.Errorf("sort %s: %w", path, err)
+		}
+
+		current, err = e.updatePath(current, path, func(val interface{}, _ pathMatch) (interface{}, error) {
+			arr, ok := val.([]interface{})
+			if !ok {
+				return val, nil
+			}
+			e.sortArray(arr, cfg)
+			return arr, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return current, nil
+}
+
+func parseSortConfig(raw interface{}) (sortConfig, error) {
+	cfg := sortConfig{Compare: "auto"}
+
+	m, ok := raw.(map[string]interface{})
+	if !ok {
+		return cfg, fmt.Errorf("expected map, got %T", raw)
+	}
+	if err := checkKeys(m, "by", "order", "compare"); err != nil {
+		return cfg, err
+	}
+
+	switch by := m["by"].(type) {
+	case nil:
+	case string:
+		cfg.By = by
+	default:
+		return cfg, fmt.Errorf("by must be a field path, got %T", by)
+	}
+
+	switch order := m["order"]; order {
+	case nil, "asc":
+	case "desc":
+		cfg.Descending = true
+	default:
+		return cfg, fmt.Errorf("unknown order %v", order)
+	}
+
+	switch compare := m["compare"]; compare {
+	case nil:
+	case "auto", "number", "string":
+		cfg.Compare = compare.(string)
+	default:
+		return cfg, fmt.Errorf("unknown compare mode %v", compare)
+	}
+
+	return cfg, nil
+}
+
+// sortArray sorts in place. Elements missing the sort value always go last.
+func (e *Engine) sortArray(arr []interface{}, cfg sortConfig) {
+	keyOf := func(item interface{}) interface{} {
+		if cfg.By == "" {
+			return item
+		}
+		if m, ok := item.(map[string]interface{}); ok {
+			val, _ := lookupPath(m, cfg.By)
+			return val
+		}
+		return nil
+	}
+
+	sort.SliceStable(arr, func(i, j int) bool {
+		a, b := keyOf(arr[i]), keyOf(arr[j])
+		if a == nil || b == nil {
+			return a != nil
+		}
+
+		c := compareValues(a, b, cfg.Compare)
+		if cfg.Descending {
+			return c > 0
+		}
+		return c < 0
+	})
+}
+
+// compareValues returns -1, 0 or 1.
+// Numbers compare numerically and sort before everything else, which compares
+// as text. "number" mode also treats numeric strings as numbers.
+func compareValues(a, b interface{}, mode string) int {
+	if mode != "string" {
+		af, aok := expr.ToNumber(a)
+		bf, bok := expr.ToNumber(b)
+		if mode == "auto" {
+			_, aStr := a.(string)
+			_, bStr := b.(string)
+			aok, bok = aok && !aStr, bok && !bStr
+		}
+
+		if aok && bok {
+			return compareFloats(af, bf)
+		}
+		if aok != bok {
+			if aok {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	return strings.Compare(fmt.Sprintf("%v", a), fmt.Sprintf("%v", b))
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// checkKeys rejects spec keys outside allowed, so a misspelt option fails
+// instead of being ignored.
+func checkKeys(m map[string]interface{}, allowed ...string) error {
+	known := make(map[string]bool, len(allowed))
+	for _, k := range allowed {
+		known[k] = true
+	}
+
+	var unknown []string
+	for k := range m {
+		if !known[k] {
+			unknown = append(unknown, fmt.Sprintf("%q", k))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	sort.Strings(unknown)
+	return fmt.Errorf("unknown option %s", strings.Join(unknown, ", "))
+}
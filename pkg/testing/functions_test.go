@@ -2,6 +2,8 @@ package jmap_test
 
 import (
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 
 	jmap "github.com/iammehrabsandhu/jmap/pkg"
@@ -148,3 +150,557 @@ func TestLookupFunction(t *testing.T) {
 		}
 	}
 }
+
+func TestNestedFunctionCalls(t *testing.T) {
+	input := `{
+		"users": [
+			{"first": "John", "last": "Doe", "type": "admin", "region": "eu"},
+			{"first": "Jane", "last": "Smith", "type": "guest"}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"users": {
+						"*": {
+							"first": "names.@concat(@(1,last), ', ', @, ' (', lookup(@(1,type), 'admin', 'A', 'U'), ')')",
+							"region": "regions.@concat('it\\'s ', @)"
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	result, err := jmap.Transform(input, &spec)
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &output); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+
+	names, ok := output["names"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected names map, got %T", output["names"])
+	}
+	if names["Doe, John (A)"] != "John" || names["Smith, Jane (U)"] != "Jane" {
+		t.Errorf("Expected keys built from nested calls, got %v", names)
+	}
+
+	regions, ok := output["regions"].(map[string]interface{})
+	if !ok || regions["it's eu"] != "eu" {
+		t.Errorf("Expected escaped quote in key, got %v", output["regions"])
+	}
+}
+
+func TestFunctionSyntaxError(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {"users": {"*": "ids.@concat(first, '_' last)"}}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"users": [{"first": "John", "last": "Doe"}]}`, &spec)
+	if err == nil {
+		t.Fatal("Expected a syntax error for a malformed call")
+	}
+	if !strings.Contains(err.Error(), `expected "," or ")" in call to concat, got "last" at position 23`) {
+		t.Errorf("Expected positioned syntax error, got %v", err)
+	}
+}
+
+func TestStringFunctions(t *testing.T) {
+	input := `{
+		"name": "  mARY-jane o'neil  ",
+		"email": "Mary.Jane@Example.COM",
+		"sku": "ab-123-xyz",
+		"tags": ["red", null, "blue"],
+		"csv": "a,b,,c",
+		"digits": "[0-9]+",
+		"id": 42
+	}`
+
+	exprs := map[string]string{
+		"trimmed":  "trim(name)",
+		"title":    "titleCase(trim(name))",
+		"lowered":  "lower(email)",
+		"uppered":  "upper(sku)",
+		"middle":   "substring(sku, 3, -4)",
+		"tail":     "substring(sku, -3)",
+		"joined":   "join(tags, '|')",
+		"parts":    "length(split(csv, ','))",
+		"dashless": "replace(sku, '-', '')",
+		"padded":   "padLeft(id, 6, '0')",
+		"right":    "padRight('ab', 5, 'xy')",
+		"isCorp":   "endsWith(lower(email), '@example.com') && startsWith(sku, 'ab')",
+		"chars":    "length('héllo')",
+		"domain":   "regexExtract(email, '@(.+)$', 1)",
+		"number":   "regexExtract(sku, '[0-9]+')",
+		"nomatch":  "regexExtract(sku, 'q+')",
+		"masked":   "regexReplace(sku, '([a-z]+)-([0-9]+)', '$2-$1')",
+		"dynamic":  "regexReplace(sku, digits, '#')",
+		"missing":  "upper(nothing)",
+	}
+
+	spec := map[string]interface{}{}
+	for field, e := range exprs {
+		spec[field] = "=" + e
+	}
+	specBytes, _ := json.Marshal(map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{"type": "modify-overwrite", "spec": spec},
+		},
+	})
+
+	output := runTransform(t, input, string(specBytes))
+
+	want := map[string]interface{}{
+		"trimmed":  "mARY-jane o'neil",
+		"title":    "Mary-Jane O'neil",
+		"lowered":  "mary.jane@example.com",
+		"uppered":  "AB-123-XYZ",
+		"middle":   "123",
+		"tail":     "xyz",
+		"joined":   "red|blue",
+		"parts":    4.0,
+		"dashless": "ab123xyz",
+		"padded":   "000042",
+		"right":    "abxyx",
+		"isCorp":   true,
+		"chars":    5.0,
+		"domain":   "Example.COM",
+		"number":   "123",
+		"nomatch":  nil,
+		"masked":   "123-ab-xyz",
+		"dynamic":  "ab-#-xyz",
+		"missing":  nil,
+	}
+	for field, expected := range want {
+		if got := output[field]; got != expected {
+			t.Errorf("%s = %s: expected %#v, got %#v", field, exprs[field], expected, got)
+		}
+	}
+}
+
+func TestInvalidLiteralPattern(t *testing.T) {
+	specJSON := `{"operations": [{"type": "modify-overwrite", "spec": {"out": "=regexReplace(nothing, '[a-', '')"}}]}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	// The pattern is checked when the expression is parsed, even though the
+	// text it would apply to is missing.
+	_, err := jmap.Transform(`{}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), "regexReplace: invalid pattern") {
+		t.Fatalf("Expected invalid pattern error, got %v", err)
+	}
+}
+
+func TestStringFunctionsInOutputPath(t *testing.T) {
+	input := `{"users": [{"email": " Ann@X.com "}, {"email": "bob@y.org"}]}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"users": {"*": {"email": "byUser.@lower(regexExtract(trim(@), '^[^@]+'))"}}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	byUser, ok := output["byUser"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected byUser map, got %T", output["byUser"])
+	}
+	if byUser["ann"] != " Ann@X.com " || byUser["bob"] != "bob@y.org" {
+		t.Errorf("Expected keys built from the normalized user name, got %v", byUser)
+	}
+}
+
+func TestLongNumbersAsText(t *testing.T) {
+	input := `{"users": [{"id": 12345678}]}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "modify-overwrite",
+				"spec": {
+					"users": {
+						"*": {
+							"key": "=concat('id_', id)",
+							"padded": "=padLeft(id, 10, '0')",
+							"upper": "=upper(id)"
+						}
+					}
+				}
+			},
+			{
+				"type": "shift",
+				"spec": {
+					"users": {"*": {"@": "byId.@concat('k', id)"}}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	byID, _ := output["byId"].(map[string]interface{})
+	user, ok := byID["k12345678"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected byId.k12345678, got %v", output["byId"])
+	}
+	want := map[string]interface{}{
+		"key":    "id_12345678",
+		"padded": "0012345678",
+		"upper":  "12345678",
+	}
+	for field, expected := range want {
+		if user[field] != expected {
+			t.Errorf("Expected %s=%q, got %#v", field, expected, user[field])
+		}
+	}
+}
+
+func TestMathFunctions(t *testing.T) {
+	input := `{
+		"cents": 1999,
+		"price": 19.99,
+		"amount": "100000,50",
+		"fees": [0.1, 0.1, 0.1],
+		"a": 0.1,
+		"b": 0.2,
+		"scores": [3, 9, 4],
+		"item": {"price": "4.25"}
+	}`
+
+	exprs := map[string]string{
+		"units":     "divide(cents, 100)",
+		"total":     "multiply(price, 3)",
+		"sumAB":     "a + b",
+		"added":     "add(a, b, 1)",
+		"diff":      "subtract(1, b, a)",
+		"feeTotal":  "sum(fees)",
+		"rounded":   "round(2.345, 2)",
+		"negative":  "round(-2.5)",
+		"hundreds":  "round(1250, -2)",
+		"floored":   "floor(price)",
+		"ceiled":    "ceil(price)",
+		"absolute":  "abs(0 - price)",
+		"remainder": "mod(5.5, 2)",
+		"smallest":  "min(7, cents, 3)",
+		"largest":   "max(scores)",
+		"oneItem":   "min(item, price)",
+		"parsed":    "toNumber(amount, ',')",
+		"plain":     "toNumber('12.50') * 2",
+		"invalid":   "toNumber('abc')",
+		"missing":   "add(nothing, 1)",
+	}
+
+	spec := map[string]interface{}{}
+	for field, e := range exprs {
+		spec[field] = "=" + e
+	}
+	specBytes, _ := json.Marshal(map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{"type": "modify-overwrite", "spec": spec},
+		},
+	})
+
+	output := runTransform(t, input, string(specBytes))
+
+	want := map[string]interface{}{
+		"units":     19.99,
+		"total":     59.97,
+		"sumAB":     0.3,
+		"added":     1.3,
+		"diff":      0.7,
+		"feeTotal":  0.3,
+		"rounded":   2.35,
+		"negative":  -3.0,
+		"hundreds":  1300.0,
+		"floored":   19.0,
+		"ceiled":    20.0,
+		"absolute":  19.99,
+		"remainder": 1.5,
+		"smallest":  3.0,
+		"largest":   9.0,
+		"oneItem":   4.25,
+		"parsed":    100000.5,
+		"plain":     25.0,
+		"invalid":   nil,
+		"missing":   nil,
+	}
+	for field, expected := range want {
+		if got := output[field]; got != expected {
+			t.Errorf("%s = %s: expected %#v, got %#v", field, exprs[field], expected, got)
+		}
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{"type": "modify-overwrite", "spec": {"ratio": "=divide(a, b)"}}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"a": 1, "b": 0}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), "divide at position 0: division by zero") {
+		t.Fatalf("Expected division by zero error, got %v", err)
+	}
+}
+
+func TestDateFunctions(t *testing.T) {
+	input := `{
+		"dob": "01/31/1990",
+		"departure": "2023-11-01T08:00:00",
+		"arrival": "2023-11-01T16:30:00",
+		"created": 1700000000,
+		"createdMillis": 1700000000123,
+		"header": "Wed, 01 Nov 2023 08:00:00 GMT",
+		"stamp": "2023-03-25T23:30:00Z"
+	}`
+
+	exprs := map[string]string{
+		"birthDate":   "formatDate(parseDate(dob, 'MM/dd/yyyy'), 'yyyy-MM-dd')",
+		"isoDob":      "parseDate(dob, 'MM/dd/yyyy')",
+		"localDep":    "parseDate(departure, 'iso', 'America/New_York')",
+		"depInParis":  "convertZone(parseDate(departure, 'iso', 'America/New_York'), 'Europe/Paris')",
+		"duration":    "dateDiff(departure, arrival, 'hours')",
+		"durationMin": "dateDiff(departure, arrival, 'minutes')",
+		"fromEpoch":   "parseDate(created)",
+		"fromMillis":  "formatDate(createdMillis, 'yyyy-MM-dd HH:mm:ss.SSS')",
+		"toEpoch":     "formatDate(header, 'epochSeconds')",
+		"toMillis":    "formatDate(departure, 'epochMillis')",
+		"pretty":      "formatDate(stamp, 'EEE, dd MMM yyyy hh:mm a', 'Europe/Berlin')",
+		"rfc":         "formatDate(stamp, 'rfc1123')",
+		"plusIso":     "addDuration(stamp, 'P1M2DT1H')",
+		"plusGo":      "addDuration(stamp, '-90m')",
+		"nextWeek":    "addDuration('2024-02-26', 'P1W')",
+		"monthEnd":    "addDuration('2024-01-31', 'P1M')",
+		"leapYear":    "addDuration('2024-02-29', 'P1Y')",
+		"backMonth":   "addDuration('2024-03-31', '-P1M')",
+		"literal":     "formatDate(stamp, \"yyyy-MM-dd'T'HH:mm:ssXXX\")",
+		"quarter":     "formatDate(stamp, \"yyyy 'Q1' 'at' h\")",
+		"readQuarter": "parseDate('2023 Q1 05', \"yyyy 'Q1' MM\")",
+		"eastern":     "parseDate('Wed, 01 Nov 2023 08:00:00 EST')",
+		"numericDay":  "parseDate(20231101, 'yyyyMMdd')",
+		"commaMillis": "formatDate(createdMillis, 'HH:mm:ss,SSS')",
+		"missing":     "formatDate(nothing, 'yyyy')",
+	}
+
+	spec := map[string]interface{}{}
+	for field, e := range exprs {
+		spec[field] = "=" + e
+	}
+	specBytes, _ := json.Marshal(map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{"type": "modify-overwrite", "spec": spec},
+		},
+	})
+
+	output := runTransform(t, input, string(specBytes))
+
+	want := map[string]interface{}{
+		"birthDate":   "1990-01-31",
+		"isoDob":      "1990-01-31T00:00:00Z",
+		"localDep":    "2023-11-01T08:00:00-04:00",
+		"depInParis":  "2023-11-01T13:00:00+01:00",
+		"duration":    8.5,
+		"durationMin": 510.0,
+		"fromEpoch":   "2023-11-14T22:13:20Z",
+		"fromMillis":  "2023-11-14 22:13:20.123",
+		"toEpoch":     1698825600.0,
+		"toMillis":    1698825600000.0,
+		"pretty":      "Sun, 26 Mar 2023 12:30 AM",
+		"rfc":         "Sat, 25 Mar 2023 23:30:00 UTC",
+		"plusIso":     "2023-04-28T00:30:00Z",
+		"plusGo":      "2023-03-25T22:00:00Z",
+		"nextWeek":    "2024-03-04T00:00:00Z",
+		"monthEnd":    "2024-02-29T00:00:00Z",
+		"leapYear":    "2025-02-28T00:00:00Z",
+		"backMonth":   "2024-02-29T00:00:00Z",
+		"literal":     "2023-03-25T23:30:00Z",
+		"quarter":     "2023 Q1 at 11",
+		"readQuarter": "2023-05-01T00:00:00Z",
+		"eastern":     "2023-11-01T08:00:00-05:00",
+		"numericDay":  "2023-11-01T00:00:00Z",
+		"commaMillis": "22:13:20,123",
+		"missing":     nil,
+	}
+	for field, expected := range want {
+		if got := output[field]; got != expected {
+			t.Errorf("%s = %s: expected %#v, got %#v", field, exprs[field], expected, got)
+		}
+	}
+}
+
+func TestDateFunctionErrors(t *testing.T) {
+	cases := map[string]string{
+		"formatDate(d, 'yyyy', 'Mars/Olympus')":                 `unknown time zone "Mars/Olympus"`,
+		"parseDate(d, 'dd.MM.yyyy')":                            `cannot read "2023-01-02" as a date in format "dd.MM.yyyy"`,
+		"formatDate(d, 'yyyy-QQ')":                              `unsupported date pattern "QQ"`,
+		"addDuration(d, 'P1X')":                                 `invalid duration "P1X"`,
+		"parseDate('Wed, 01 Nov 2023 08:00:00 XST', 'rfc1123')": `unknown time zone abbreviation "XST"`,
+	}
+
+	for e, wantErr := range cases {
+		specJSON := fmt.Sprintf(`{"operations": [{"type": "modify-overwrite", "spec": {"out": %q}}]}`, "="+e)
+
+		var spec types.TransformSpec
+		if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+			t.Fatalf("Failed to parse spec: %v", err)
+		}
+
+		_, err := jmap.Transform(`{"d": "2023-01-02"}`, &spec)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: expected error containing %s, got %v", e, wantErr, err)
+		}
+	}
+}
+
+func TestArrayFunctions(t *testing.T) {
+	input := `{
+		"name": [
+			{"use": "official", "given": ["Peter", "James"], "family": "Chalmers"},
+			{"use": "usual", "given": ["Jim"]}
+		],
+		"address": [
+			{"city": "PleasantVille", "line": ["534 Erewhon St", "Unit 2"]},
+			{"city": "PleasantVille", "line": ["PO Box 7"]},
+			{"city": "Springfield", "line": ["1 Main St"]}
+		],
+		"codes": ["a", "b", "a", "c", "b"],
+		"sparse": ["a", null, "a", "b"],
+		"telecom": [{"system": "phone", "value": "555"}, {"system": "email", "value": "p@x.org"}]
+	}`
+
+	exprs := map[string]string{
+		"firstGiven":   "first(name[0].given)",
+		"allGiven":     "flattenArray(name[*].given)",
+		"lastLine":     "last(flattenArray(address[*].line))",
+		"lastTwo":      "slice(codes, -2)",
+		"middle":       "slice(codes, 1, -1)",
+		"reversed":     "reverse(codes)",
+		"uniqueCodes":  "unique(codes)",
+		"cities":       "length(unique(address, city))",
+		"firstPerCity": "map(distinct(address, city), line[0])",
+		"uniqueSparse": "unique(sparse)",
+		"position":     "indexOf(codes, 'c')",
+		"absent":       "indexOf(codes, 'z')",
+		"inText":       "indexOf('héllo', 'llo')",
+		"hasB":         "contains(codes, 'b')",
+		"hasEmail":     "contains(map(telecom, system), 'email')",
+		"contacts":     "join(map(telecom, concat(system, ':', value)), ', ')",
+		"shallow":      "length(flattenArray(address[*].line, 0))",
+		"firstOfEmpty": "first(slice(codes, 10))",
+		"missing":      "first(nothing)",
+	}
+
+	spec := map[string]interface{}{}
+	for field, e := range exprs {
+		spec[field] = "=" + e
+	}
+	specBytes, _ := json.Marshal(map[string]interface{}{
+		"operations": []interface{}{
+			map[string]interface{}{"type": "modify-overwrite", "spec": spec},
+		},
+	})
+
+	output := runTransform(t, input, string(specBytes))
+
+	want := map[string]interface{}{
+		"firstGiven":   "Peter",
+		"allGiven":     "[Peter James Jim]",
+		"lastLine":     "1 Main St",
+		"lastTwo":      "[c b]",
+		"middle":       "[b a c]",
+		"reversed":     "[b c a b a]",
+		"uniqueCodes":  "[a b c]",
+		"cities":       2.0,
+		"firstPerCity": "[534 Erewhon St 1 Main St]",
+		"uniqueSparse": "[a b]",
+		"position":     3.0,
+		"absent":       -1.0,
+		"inText":       2.0,
+		"hasB":         true,
+		"hasEmail":     true,
+		"contacts":     "phone:555, email:p@x.org",
+		"shallow":      3.0,
+		"firstOfEmpty": nil,
+		"missing":      nil,
+	}
+	for field, expected := range want {
+		got := output[field]
+		if list, ok := got.([]interface{}); ok {
+			got = fmt.Sprint(list)
+		}
+		if got != expected {
+			t.Errorf("%s = %s: expected %#v, got %#v", field, exprs[field], expected, got)
+		}
+	}
+}
+
+func TestMathRejectsNonFinite(t *testing.T) {
+	cases := map[string]string{
+		"=nan + 1":           `non-numeric value "NaN"`,
+		"=floor(inf)":        `non-numeric value "Infinity"`,
+		"=add(hex, 1)":       `non-numeric value "0x1p4"`,
+		"=grouped * 2":       `non-numeric value "1_000"`,
+		"=multiply(big, 10)": "result is not a finite number",
+	}
+
+	for e, wantErr := range cases {
+		specJSON := fmt.Sprintf(`{"operations": [{"type": "modify-overwrite", "spec": {"out": %q}}]}`, e)
+
+		var spec types.TransformSpec
+		if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+			t.Fatalf("Failed to parse spec: %v", err)
+		}
+
+		_, err := jmap.Transform(`{"nan": "NaN", "inf": "Infinity", "hex": "0x1p4", "grouped": "1_000", "big": 1e308}`, &spec)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: expected error containing %s, got %v", e, wantErr, err)
+		}
+	}
+
+	output := runTransform(t, `{"n": "toNumber"}`, `{
+		"operations": [
+			{"type": "modify-overwrite", "spec": {"nan": "=toNumber('NaN')", "exp": "=toNumber(' 1.5e2 ')"}}
+		]
+	}`)
+	if output["nan"] != nil || output["exp"] != 150.0 {
+		t.Errorf("Expected toNumber to reject NaN and accept exponents, got %v", output)
+	}
+}
@@ -0,0 +1,1085 @@
+package jmap_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	jmap "github.com/iammehrabsandhu/jmap/pkg"
+	"github.com/iammehrabsandhu/jmap/types"
+)
+
+// runTransform applies specJSON to input and decodes the result.
+func runTransform(t *testing.T, input, specJSON string) map[string]interface{} {
+	t.Helper()
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	result, err := jmap.Transform(input, &spec)
+	if err != nil {
+		t.Fatalf("Transform failed: %v", err)
+	}
+
+	var output map[string]interface{}
+	if err := json.Unmarshal([]byte(result), &output); err != nil {
+		t.Fatalf("Failed to parse result: %v", err)
+	}
+	return output
+}
+
+func TestRemoveOperation(t *testing.T) {
+	input := `{
+		"customer": {
+			"name": "Alice",
+			"ssn": "123-45-6789",
+			"internalId": "c-1"
+		},
+		"items": [
+			{"sku": "A", "internalId": "i-1"},
+			{"sku": "B", "internalId": "i-2"}
+		],
+		"tags": ["x", "y", "z"]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "remove",
+				"spec": {
+					"customer": {
+						"ssn": "",
+						"internalId": ""
+					},
+					"items": {
+						"*": {
+							"internalId": ""
+						}
+					},
+					"tags": {
+						"1": ""
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	customer, ok := output["customer"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected customer map, got %T", output["customer"])
+	}
+	if _, exists := customer["ssn"]; exists {
+		t.Errorf("Expected ssn to be removed")
+	}
+	if _, exists := customer["internalId"]; exists {
+		t.Errorf("Expected customer.internalId to be removed")
+	}
+	if customer["name"] != "Alice" {
+		t.Errorf("Expected name=Alice, got %v", customer["name"])
+	}
+
+	items, ok := output["items"].([]interface{})
+	if !ok || len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %v", output["items"])
+	}
+	for i, item := range items {
+		m := item.(map[string]interface{})
+		if _, exists := m["internalId"]; exists {
+			t.Errorf("Expected items[%d].internalId to be removed", i)
+		}
+		if m["sku"] == nil {
+			t.Errorf("Expected items[%d].sku to be kept", i)
+		}
+	}
+
+	tags, ok := output["tags"].([]interface{})
+	if !ok || len(tags) != 2 || tags[0] != "x" || tags[1] != "z" {
+		t.Errorf("Expected tags [x z], got %v", output["tags"])
+	}
+}
+
+func TestRemoveAfterShift(t *testing.T) {
+	input := `{"items": [{"val": "a", "secret": 1}, {"val": "b", "secret": 2}]}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"items": {
+						"*": {
+							"val": "out[&1].value",
+							"secret": "out[&1].secret"
+						}
+					}
+				}
+			},
+			{
+				"type": "remove",
+				"spec": {
+					"out": {
+						"*": {
+							"secret": ""
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	out, ok := output["out"].([]interface{})
+	if !ok || len(out) != 2 {
+		t.Fatalf("Expected out array of 2, got %v", output["out"])
+	}
+	for i, item := range out {
+		m := item.(map[string]interface{})
+		if _, exists := m["secret"]; exists {
+			t.Errorf("Expected out[%d].secret to be removed", i)
+		}
+	}
+}
+
+func TestSortOperation(t *testing.T) {
+	input := `{
+		"orders": [
+			{
+				"id": "o1",
+				"line_items": [
+					{"sku": "B", "price": "10.5"},
+					{"sku": "A", "price": "9"},
+					{"sku": "C"},
+					{"sku": "D", "price": "100"}
+				]
+			}
+		],
+		"tags": ["pear", "apple", "fig"]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "sort",
+				"spec": {
+					"keys": true,
+					"arrays": {
+						"orders[*].line_items": {"by": "price", "order": "desc", "compare": "number"},
+						"tags": {}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	order := output["orders"].([]interface{})[0].(map[string]interface{})
+	items := order["line_items"].([]interface{})
+
+	var skus []string
+	for _, item := range items {
+		skus = append(skus, item.(map[string]interface{})["sku"].(string))
+	}
+	if got := fmt.Sprint(skus); got != "[D B A C]" {
+		t.Errorf("Expected line items sorted [D B A C], got %s", got)
+	}
+
+	if got := fmt.Sprint(output["tags"]); got != "[apple fig pear]" {
+		t.Errorf("Expected tags [apple fig pear], got %s", got)
+	}
+}
+
+func TestSortInvalidSpec(t *testing.T) {
+	cases := map[string]string{
+		`{"key": true}`:   `unknown option "key"`,
+		`{"keys": false}`: "keys must be true",
+		`{"arrays": {"tags": {"order": "asc", "by": "x", "desc": true}}}`: `unknown option "desc"`,
+		`{"arrays": {"tags": {"by": 1}}}`:                                 "by must be a field path",
+	}
+
+	for sortSpec, wantErr := range cases {
+		specJSON := fmt.Sprintf(`{"operations": [{"type": "sort", "spec": %s}]}`, sortSpec)
+
+		var spec types.TransformSpec
+		if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+			t.Fatalf("Failed to parse spec: %v", err)
+		}
+
+		_, err := jmap.Transform(`{"tags": ["b", "a"]}`, &spec)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: expected error containing %s, got %v", sortSpec, wantErr, err)
+		}
+	}
+}
+
+func TestCardinalityOperation(t *testing.T) {
+	input := `{
+		"customer": [{"name": "Alice"}, {"name": "Bob"}],
+		"items": {"sku": "A", "tags": "sale"},
+		"empty": []
+	}`
+
+	// Normalize shapes first so the shift spec only has to handle one.
+	specJSON := `{
+		"operations": [
+			{
+				"type": "cardinality",
+				"spec": {
+					"customer": "ONE",
+					"empty": "ONE",
+					"items": {
+						"@": "MANY",
+						"*": {"tags": "MANY"}
+					}
+				}
+			},
+			{
+				"type": "shift",
+				"spec": {
+					"customer": {"name": "buyer"},
+					"empty": "none",
+					"items": {
+						"*": {
+							"sku": "lines[&1].sku",
+							"tags": "lines[&1].tags"
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	if output["buyer"] != "Alice" {
+		t.Errorf("Expected buyer=Alice, got %v", output["buyer"])
+	}
+	if v, exists := output["none"]; !exists || v != nil {
+		t.Errorf("Expected none=null, got %v", v)
+	}
+
+	lines, ok := output["lines"].([]interface{})
+	if !ok || len(lines) != 1 {
+		t.Fatalf("Expected one line, got %v", output["lines"])
+	}
+	line := lines[0].(map[string]interface{})
+	if line["sku"] != "A" {
+		t.Errorf("Expected sku=A, got %v", line["sku"])
+	}
+	if got := fmt.Sprint(line["tags"]); got != "[sale]" {
+		t.Errorf("Expected tags [sale], got %s", got)
+	}
+}
+
+func TestModifyOperations(t *testing.T) {
+	input := `{
+		"name": [
+			{
+				"use": "official",
+				"family": "Chalmers",
+				"given": ["Peter", "James"]
+			}
+		],
+		"gender": "male",
+		"status": null
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "modify-overwrite",
+				"spec": {
+					"name": {
+						"*": {
+							"fullName": "=concat(given, ' ', family)",
+							"use": "=concat(@(0), '/', @(3,gender))"
+						}
+					}
+				}
+			},
+			{
+				"type": "modify-default",
+				"spec": {
+					"gender": "unknown",
+					"status": "ACTIVE",
+					"version": 2
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	name := output["name"].([]interface{})[0].(map[string]interface{})
+	if name["fullName"] != "Peter James Chalmers" {
+		t.Errorf("Expected fullName='Peter James Chalmers', got %v", name["fullName"])
+	}
+	if name["use"] != "official/male" {
+		t.Errorf("Expected use='official/male', got %v", name["use"])
+	}
+
+	if output["gender"] != "male" {
+		t.Errorf("Expected modify-default to keep gender=male, got %v", output["gender"])
+	}
+	if output["status"] != "ACTIVE" {
+		t.Errorf("Expected modify-default to fill null status, got %v", output["status"])
+	}
+	if output["version"] != 2.0 {
+		t.Errorf("Expected version=2, got %v", output["version"])
+	}
+}
+
+func TestModifyDottedIndices(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "modify-overwrite",
+				"spec": {"a": "=grid.0.1", "b": "=grid.1.0", "c": "=grid.1.0 + 0.5"}
+			}
+		]
+	}`
+
+	output := runTransform(t, `{"grid": [[1, 2], [3, 4]]}`, specJSON)
+
+	want := map[string]interface{}{"a": 2.0, "b": 3.0, "c": 3.5}
+	for field, expected := range want {
+		if output[field] != expected {
+			t.Errorf("Expected %s=%v, got %v", field, expected, output[field])
+		}
+	}
+}
+
+func TestModifyEmptyNestedSpec(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "modify-overwrite",
+				"spec": {"x": {"*": {"y": "1"}}, "z": {"y": "1"}}
+			}
+		]
+	}`
+
+	output := runTransform(t, `{"a": 1}`, specJSON)
+
+	if v, exists := output["x"]; exists {
+		t.Errorf("Expected no x when nothing matched under it, got %v", v)
+	}
+	if z, _ := output["z"].(map[string]interface{}); z["y"] != "1" {
+		t.Errorf("Expected z.y=1 to be created, got %v", output["z"])
+	}
+}
+
+func TestModifyInvalidExpression(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "modify-overwrite",
+				"spec": {"a": "=concat(b, "}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	if _, err := jmap.Transform(`{"b": "x"}`, &spec); err == nil {
+		t.Fatal("Expected error for malformed expression")
+	}
+}
+
+func TestFilterOperation(t *testing.T) {
+	input := `{
+		"users": [
+			{"name": "ann", "active": true, "age": 34, "email": "ann@corp.com"},
+			{"name": "bob", "active": false, "age": 41, "email": "bob@corp.com"},
+			{"name": "cid", "active": true, "age": 16, "email": "cid@corp.com"},
+			{"name": "dee", "active": true, "age": 29, "email": "dee@gmail.com"},
+			{"name": "eve", "active": true, "email": "eve@corp.com"}
+		],
+		"orders": [
+			{"id": "o1", "minQty": 1, "line_items": [{"sku": "A", "quantity": 0}, {"sku": "B", "quantity": "2"}]},
+			{"id": "o2", "minQty": 3, "line_items": [{"sku": "C", "quantity": 5}, {"sku": "D", "quantity": 2}]}
+		],
+		"tags": ["keep", "", "also"]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "filter",
+				"spec": {
+					"users": "active == true and (age >= 18 || !exists(age)) && email =~ '@corp\\.com$'",
+					"orders[*].line_items": "quantity >= @(2,minQty)",
+					"tags": "@"
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	var names []string
+	for _, u := range output["users"].([]interface{}) {
+		names = append(names, u.(map[string]interface{})["name"].(string))
+	}
+	if got := fmt.Sprint(names); got != "[ann eve]" {
+		t.Errorf("Expected users [ann eve], got %s", got)
+	}
+
+	for i, want := range []string{"[B]", "[C]"} {
+		order := output["orders"].([]interface{})[i].(map[string]interface{})
+		var skus []string
+		for _, item := range order["line_items"].([]interface{}) {
+			skus = append(skus, item.(map[string]interface{})["sku"].(string))
+		}
+		if got := fmt.Sprint(skus); got != want {
+			t.Errorf("Expected orders[%d].line_items %s, got %s", i, want, got)
+		}
+	}
+
+	if got := fmt.Sprint(output["tags"]); got != "[keep also]" {
+		t.Errorf("Expected tags [keep also], got %s", got)
+	}
+}
+
+func TestFilterInvalidPredicate(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "filter",
+				"spec": {"users": "age >"}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"users": []}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), "position 5") {
+		t.Fatalf("Expected syntax error at position 5, got %v", err)
+	}
+}
+
+func TestGroupByOperation(t *testing.T) {
+	input := `{
+		"transactions": [
+			{"id": "t1", "accountId": "acc-1", "amount": 10},
+			{"id": "t2", "accountId": "acc-2", "amount": 20},
+			{"id": "t3", "accountId": "acc-1", "amount": 30}
+		],
+		"users": [
+			{"first": "Ann", "last": "Lee", "id": 1},
+			{"first": "Ann", "last": "Lee", "id": 2}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "groupBy",
+				"spec": {
+					"transactions": {"by": "accountId", "target": "byAccount"},
+					"users": {"by": "concat(first, '_', last)", "onCollision": "first"}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	byAccount, ok := output["byAccount"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected byAccount map, got %T", output["byAccount"])
+	}
+	acc1, _ := byAccount["acc-1"].([]interface{})
+	if len(acc1) != 2 || acc1[0].(map[string]interface{})["id"] != "t1" || acc1[1].(map[string]interface{})["id"] != "t3" {
+		t.Errorf("Expected acc-1 to collect t1 and t3, got %v", byAccount["acc-1"])
+	}
+	if len(output["transactions"].([]interface{})) != 3 {
+		t.Errorf("Expected original transactions to be kept when a target is set")
+	}
+
+	users, ok := output["users"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected users to be pivoted in place, got %T", output["users"])
+	}
+	annLee, _ := users["Ann_Lee"].(map[string]interface{})
+	if annLee["id"] != 1.0 {
+		t.Errorf("Expected first-wins to keep id=1, got %v", users["Ann_Lee"])
+	}
+}
+
+func TestGroupByCollisionError(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "groupBy",
+				"spec": {"users": {"by": "id", "onCollision": "error"}}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"users": [{"id": 1}, {"id": 1}]}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), "duplicate group key") {
+		t.Fatalf("Expected duplicate key error, got %v", err)
+	}
+}
+
+func TestUnknownOptions(t *testing.T) {
+	cases := map[string]string{
+		`{"type": "groupBy", "spec": {"users": {"by": "id", "onColision": "error"}}}`: `unknown option "onColision"`,
+		`{"type": "merge", "spec": {"target": "a", "from": "b", "array": "concat"}}`:  `unknown option "array"`,
+	}
+
+	for op, wantErr := range cases {
+		var spec types.TransformSpec
+		if err := json.Unmarshal([]byte(`{"operations": [`+op+`]}`), &spec); err != nil {
+			t.Fatalf("Failed to parse spec: %v", err)
+		}
+
+		_, err := jmap.Transform(`{"users": [{"id": 1}], "b": {"x": 1}}`, &spec)
+		if err == nil || !strings.Contains(err.Error(), wantErr) {
+			t.Errorf("%s: expected error containing %s, got %v", op, wantErr, err)
+		}
+	}
+}
+
+func TestAggregateOperation(t *testing.T) {
+	input := `{
+		"line_items": [
+			{"title": "IPod Nano", "price": "199.00", "quantity": 1, "vendor": "Apple"},
+			{"title": "IPod Touch", "price": "99.50", "quantity": 2, "vendor": "Apple"},
+			{"title": "Case", "price": "0.00", "quantity": 3, "vendor": "Acme", "gift_card": true}
+		],
+		"orders": [
+			{"id": "o1", "items": [{"amount": 5}, {"amount": 7}]},
+			{"id": "o2", "items": []}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "aggregate",
+				"spec": {
+					"subtotal": "sum(line_items, price * quantity)",
+					"itemCount": "count(line_items)",
+					"giftCards": "count(line_items, gift_card)",
+					"cheapest": "min(line_items[*].price)",
+					"priciest": "max(line_items[*].price)",
+					"averageQuantity": "avg(line_items[*].quantity)",
+					"vendors": "distinct(line_items[*].vendor)",
+					"refunded": "sum(refunds[*].amount)",
+					"orders[*].total": "sum(items[*].amount)"
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	checks := map[string]interface{}{
+		"subtotal":        398.0,
+		"itemCount":       3.0,
+		"giftCards":       1.0,
+		"cheapest":        0.0,
+		"priciest":        199.0,
+		"averageQuantity": 2.0,
+		"refunded":        nil,
+	}
+	for field, want := range checks {
+		if output[field] != want {
+			t.Errorf("Expected %s=%v, got %v", field, want, output[field])
+		}
+	}
+
+	if got := fmt.Sprint(output["vendors"]); got != "[Apple Acme]" {
+		t.Errorf("Expected vendors [Apple Acme], got %s", got)
+	}
+
+	orders := output["orders"].([]interface{})
+	if total := orders[0].(map[string]interface{})["total"]; total != 12.0 {
+		t.Errorf("Expected orders[0].total=12, got %v", total)
+	}
+	if total := orders[1].(map[string]interface{})["total"]; total != 0.0 {
+		t.Errorf("Expected orders[1].total=0, got %v", total)
+	}
+}
+
+func TestAggregateNonNumeric(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "aggregate",
+				"spec": {"total": "sum(items[*].price)"}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"items": [{"price": "1.50"}, {"price": "n/a"}]}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), `non-numeric value "n/a"`) {
+		t.Fatalf("Expected non-numeric error, got %v", err)
+	}
+}
+
+func TestAggregateProjectionArithmetic(t *testing.T) {
+	input := `{
+		"line_items": [{"price": "2.50", "quantity": 3}, {"price": 4, "quantity": 1}],
+		"fees": [1, 2],
+		"lines": [{"a": 1}],
+		"other": [{"b": 2}]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "aggregate",
+				"spec": {
+					"subtotal": "sum(line_items[*].price * quantity)",
+					"doubledFees": "sum(fees[*] * 2)",
+					"largest": "max(line_items[*].price * quantity)"
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	want := map[string]interface{}{"subtotal": 11.5, "doubledFees": 6.0, "largest": 7.5}
+	for field, expected := range want {
+		if output[field] != expected {
+			t.Errorf("Expected %s=%v, got %v", field, expected, output[field])
+		}
+	}
+
+	var spec types.TransformSpec
+	twoLists := `{"operations": [{"type": "aggregate", "spec": {"x": "sum(lines[*].a * other[*].b)"}}]}`
+	if err := json.Unmarshal([]byte(twoLists), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+	_, err := jmap.Transform(input, &spec)
+	if err == nil || !strings.Contains(err.Error(), "cannot apply to a list") {
+		t.Fatalf("Expected list arithmetic error for two projections, got %v", err)
+	}
+}
+
+func TestFlattenOperation(t *testing.T) {
+	input := `{
+		"a": {"b": [{"c": 1}, {"c": 2, "d": []}]},
+		"meta": {"tags": ["x"], "empty": {}}
+	}`
+
+	specJSON := `{
+		"operations": [
+			{"type": "flatten"}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	want := map[string]interface{}{
+		"a.b[0].c":     1.0,
+		"a.b[1].c":     2.0,
+		"a.b[1].d":     []interface{}{},
+		"meta.tags[0]": "x",
+		"meta.empty":   map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("Expected %v, got %v", want, output)
+	}
+}
+
+func TestUnflattenRoundTrip(t *testing.T) {
+	input := `{
+		"id": "o-1",
+		"address": {"lines": ["1 Main St", "Apt 2"], "zip": "98101"},
+		"items": [{"sku": "A", "dims": {"w": 1}}, {"sku": "B"}]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{"type": "flatten", "spec": {"separator": "/", "arrays": "index"}},
+			{"type": "unflatten", "spec": {"separator": "/", "arrays": "index"}}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	var original map[string]interface{}
+	if err := json.Unmarshal([]byte(input), &original); err != nil {
+		t.Fatalf("Failed to parse input: %v", err)
+	}
+	if !reflect.DeepEqual(output, original) {
+		t.Errorf("Expected round trip to restore %v, got %v", original, output)
+	}
+}
+
+func TestUnflattenSubtree(t *testing.T) {
+	input := `{
+		"rows": [
+			{"id": "r1", "fields": {"user.name": "Ann", "user.emails[1]": "b@x.com", "user.emails[0]": "a@x.com"}}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{"type": "unflatten", "spec": {"path": "rows[*].fields"}}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	row := output["rows"].([]interface{})[0].(map[string]interface{})
+	want := map[string]interface{}{
+		"user": map[string]interface{}{
+			"name":   "Ann",
+			"emails": []interface{}{"a@x.com", "b@x.com"},
+		},
+	}
+	if !reflect.DeepEqual(row["fields"], want) {
+		t.Errorf("Expected fields %v, got %v", want, row["fields"])
+	}
+	if row["id"] != "r1" {
+		t.Errorf("Expected id to be untouched, got %v", row["id"])
+	}
+}
+
+func TestUnflattenRejectsHugeIndex(t *testing.T) {
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(`{"operations": [{"type": "unflatten"}]}`), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"a[100000000]": 1}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), "array index 100000000 out of range") {
+		t.Fatalf("Expected index range error, got %v", err)
+	}
+}
+
+func TestMergeOperation(t *testing.T) {
+	input := `{
+		"address": {"street": "1 Main St", "city": "Springfield", "zip": "11111"},
+		"billing": {"zip": "22222", "attention": "Accounts"},
+		"shipping": {"city": "Shelbyville", "zip": null},
+		"contacts": [{"type": "email", "value": "old@x.com"}, {"type": "phone", "value": "555"}],
+		"overrides": [{"type": "email", "value": "new@x.com"}, {"type": "fax", "value": "777"}],
+		"tags": ["a"]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "merge",
+				"spec": {"target": "address", "from": ["billing", "shipping"]}
+			},
+			{
+				"type": "merge",
+				"spec": {"target": "contacts", "from": "overrides", "arrays": "key", "key": "type"}
+			},
+			{
+				"type": "merge",
+				"spec": {"target": "tags", "value": ["b"], "arrays": "concat"}
+			},
+			{
+				"type": "merge",
+				"spec": {"target": "meta", "value": {"source": "crm"}}
+			},
+			{
+				"type": "merge",
+				"spec": {"target": "invoice", "from": ["missing"]}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	wantAddress := map[string]interface{}{
+		"street":    "1 Main St",
+		"city":      "Shelbyville",
+		"zip":       "22222",
+		"attention": "Accounts",
+	}
+	if !reflect.DeepEqual(output["address"], wantAddress) {
+		t.Errorf("Expected address %v, got %v", wantAddress, output["address"])
+	}
+
+	wantContacts := []interface{}{
+		map[string]interface{}{"type": "email", "value": "new@x.com"},
+		map[string]interface{}{"type": "phone", "value": "555"},
+		map[string]interface{}{"type": "fax", "value": "777"},
+	}
+	if !reflect.DeepEqual(output["contacts"], wantContacts) {
+		t.Errorf("Expected contacts %v, got %v", wantContacts, output["contacts"])
+	}
+
+	if got := fmt.Sprint(output["tags"]); got != "[a b]" {
+		t.Errorf("Expected tags [a b], got %s", got)
+	}
+
+	meta, _ := output["meta"].(map[string]interface{})
+	if meta["source"] != "crm" {
+		t.Errorf("Expected missing target to be created, got %v", output["meta"])
+	}
+	if v, exists := output["invoice"]; exists {
+		t.Errorf("Expected no target without a source, got %v", v)
+	}
+}
+
+func TestMergeConflictError(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "merge",
+				"spec": {"target": "a", "value": {"x": 2}, "onConflict": "error"}
+			}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"a": {"x": 1}}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), "merge conflict at a.x") {
+		t.Fatalf("Expected merge conflict error, got %v", err)
+	}
+}
+
+func TestMergeRequiresTarget(t *testing.T) {
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(`{"operations": [{"type": "merge", "spec": {"from": "b"}}]}`), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+
+	_, err := jmap.Transform(`{"b": {"x": 1}}`, &spec)
+	if err == nil || !strings.Contains(err.Error(), `needs a "target" path`) {
+		t.Fatalf("Expected missing target error, got %v", err)
+	}
+}
+
+func TestDefaultArrayElements(t *testing.T) {
+	input := `{
+		"items": [
+			{"sku": "A1"},
+			{"sku": "B2", "currency": "EUR"},
+			{"sku": "C3", "options": {}}
+		],
+		"slots": [null, "taken"]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "default",
+				"spec": {
+					"items": {
+						"*": {"currency": "USD", "options": {"gift": false}},
+						"[0]": {"priority": "HIGH"}
+					},
+					"slots": {"[0]": "open", "[5]": "ignored"}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	items := output["items"].([]interface{})
+	currencies := []string{"USD", "EUR", "USD"}
+	for i, item := range items {
+		m := item.(map[string]interface{})
+		if m["currency"] != currencies[i] {
+			t.Errorf("items[%d]: expected currency %s, got %v", i, currencies[i], m["currency"])
+		}
+		options, _ := m["options"].(map[string]interface{})
+		if options["gift"] != false {
+			t.Errorf("items[%d]: expected options.gift default, got %v", i, m["options"])
+		}
+	}
+
+	if items[0].(map[string]interface{})["priority"] != "HIGH" {
+		t.Errorf("Expected [0] default on first item, got %v", items[0])
+	}
+	if _, ok := items[1].(map[string]interface{})["priority"]; ok {
+		t.Errorf("Expected [0] default only on first item, got %v", items[1])
+	}
+
+	if got := fmt.Sprint(output["slots"]); got != "[open taken]" {
+		t.Errorf("Expected slots [open taken], got %s", got)
+	}
+}
+
+func TestRenameOperation(t *testing.T) {
+	input := `{
+		"customer": {"addr": {"city": "Springfield"}, "name": "Ann"},
+		"items": [{"cost": 5, "sku": "A"}, {"cost": 7, "sku": "B"}],
+		"legacy": {"a": 1, "b": 2},
+		"untouched": true
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "rename",
+				"spec": {
+					"customer.addr": "customer.address",
+					"items[*].cost": "items[*].price",
+					"legacy.*": "attributes.*",
+					"missing.field": "ignored"
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	customer := output["customer"].(map[string]interface{})
+	if _, ok := customer["addr"]; ok {
+		t.Errorf("Expected customer.addr to be removed, got %v", customer)
+	}
+	address, _ := customer["address"].(map[string]interface{})
+	if address["city"] != "Springfield" || customer["name"] != "Ann" {
+		t.Errorf("Expected renamed address next to name, got %v", customer)
+	}
+
+	for i, item := range output["items"].([]interface{}) {
+		m := item.(map[string]interface{})
+		if _, ok := m["cost"]; ok || m["price"] == nil || m["sku"] == nil {
+			t.Errorf("items[%d]: expected cost renamed to price, got %v", i, m)
+		}
+	}
+
+	wantAttrs := map[string]interface{}{"a": float64(1), "b": float64(2)}
+	if !reflect.DeepEqual(output["attributes"], wantAttrs) {
+		t.Errorf("Expected attributes %v, got %v", wantAttrs, output["attributes"])
+	}
+	if legacy := output["legacy"].(map[string]interface{}); len(legacy) != 0 {
+		t.Errorf("Expected legacy to be emptied, got %v", legacy)
+	}
+
+	if output["untouched"] != true {
+		t.Errorf("Expected untouched field to survive, got %v", output["untouched"])
+	}
+	if _, ok := output["ignored"]; ok {
+		t.Errorf("Expected missing source to be skipped")
+	}
+}
+
+func TestRenameChained(t *testing.T) {
+	specJSON := `{"operations": [{"type": "rename", "spec": {"a": "b", "b": "c"}}]}`
+
+	output := runTransform(t, `{"a": 1, "b": 2}`, specJSON)
+
+	want := map[string]interface{}{"b": float64(1), "c": float64(2)}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("Expected %v, got %v", want, output)
+	}
+}
+
+func TestCoerceOperation(t *testing.T) {
+	input := `{
+		"items": [{"qty": "3", "price": "12.50"}, {"qty": 4, "price": 8}],
+		"active": "Y",
+		"archived": "n",
+		"zip": 12345,
+		"nickname": "  ",
+		"tags": "solo",
+		"missing": null
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "coerce",
+				"spec": {
+					"fields": {
+						"items[*].qty": "int",
+						"items[*].price": "float",
+						"active": "bool",
+						"archived": "bool",
+						"zip": "string",
+						"nickname": "null-if-empty",
+						"tags": "array",
+						"missing": "int"
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	want := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"qty": float64(3), "price": 12.5},
+			map[string]interface{}{"qty": float64(4), "price": float64(8)},
+		},
+		"active":   true,
+		"archived": false,
+		"zip":      "12345",
+		"nickname": nil,
+		"tags":     []interface{}{"solo"},
+		"missing":  nil,
+	}
+	if !reflect.DeepEqual(output, want) {
+		t.Errorf("Expected %v, got %v", want, output)
+	}
+}
+
+func TestCoerceErrorPolicy(t *testing.T) {
+	input := `{"qty": "three", "flag": "maybe"}`
+
+	specJSON := `{
+		"operations": [
+			{"type": "coerce", "spec": {"fields": {"qty": "int"}}}
+		]
+	}`
+
+	var spec types.TransformSpec
+	if err := json.Unmarshal([]byte(specJSON), &spec); err != nil {
+		t.Fatalf("Failed to parse spec: %v", err)
+	}
+	_, err := jmap.Transform(input, &spec)
+	if err == nil || !strings.Contains(err.Error(), `coerce qty: cannot convert "three" to int`) {
+		t.Fatalf("Expected conversion error, got %v", err)
+	}
+
+	output := runTransform(t, input, `{
+		"operations": [
+			{
+				"type": "coerce",
+				"spec": {
+					"fields": {"qty": "int", "flag": "bool"},
+					"truthy": ["maybe"],
+					"onError": "skip"
+				}
+			}
+		]
+	}`)
+	if output["qty"] != "three" || output["flag"] != true {
+		t.Errorf("Expected skipped qty and custom truthy flag, got %v", output)
+	}
+}
@@ -41,15 +41,14 @@ package jmap
 // 				Spec: map[string]interface{}{
 // 					"items": map[string]interface{}{
 // 						"*": map[string]interface{}{
-// 							"val": "simpleList[0]", // This is still weird for list append, usually we want simpleList[&] or simpleList[]
-// 							// But let's test explicit index
+// 							"val": "simpleList[]", // Appends each value to the list
 // 						},
 // 					},
 // 				},
 // 			},
 // 		},
 // 	}
-// 	// For simple list append, jmap doesn't support "[]" syntax yet, but let's see if our fix supports [0]
+// 	// Expect simpleList to be ["a", "b"]
 // 	result2, err := jmap.Transform(input, spec2)
 // 	if err != nil {
 // 		log.Fatal(err)
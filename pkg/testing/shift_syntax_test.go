@@ -0,0 +1,462 @@
+package jmap_test
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestShiftValueReference(t *testing.T) {
+	input := `{
+		"orderId": "o-1",
+		"customer": {"id": "c-9", "name": "Alice"},
+		"items": [
+			{"sku": "A", "qty": 1},
+			{"sku": "B", "qty": 2}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"customer": {
+						"@": "buyer",
+						"name": "buyerName"
+					},
+					"items": {
+						"*": {
+							"sku": "lines[&1].sku",
+							"@(2,orderId)": "lines[&1].orderId",
+							"@(2,customer.id)": "lines[&1].customerId",
+							"@(2,missing)": "lines[&1].missing"
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	buyer, ok := output["buyer"].(map[string]interface{})
+	if !ok || buyer["id"] != "c-9" || buyer["name"] != "Alice" {
+		t.Errorf("Expected buyer to be the whole customer object, got %v", output["buyer"])
+	}
+	if output["buyerName"] != "Alice" {
+		t.Errorf("Expected buyerName=Alice, got %v", output["buyerName"])
+	}
+
+	lines, ok := output["lines"].([]interface{})
+	if !ok || len(lines) != 2 {
+		t.Fatalf("Expected 2 lines, got %v", output["lines"])
+	}
+	for i, sku := range []string{"A", "B"} {
+		line := lines[i].(map[string]interface{})
+		if line["sku"] != sku {
+			t.Errorf("Expected lines[%d].sku=%s, got %v", i, sku, line["sku"])
+		}
+		if line["orderId"] != "o-1" {
+			t.Errorf("Expected lines[%d].orderId=o-1, got %v", i, line["orderId"])
+		}
+		if line["customerId"] != "c-9" {
+			t.Errorf("Expected lines[%d].customerId=c-9, got %v", i, line["customerId"])
+		}
+		if _, exists := line["missing"]; exists {
+			t.Errorf("Did not expect lines[%d].missing", i)
+		}
+	}
+}
+
+func TestShiftKeyReference(t *testing.T) {
+	input := `{
+		"translations": {
+			"en": {"title": "Hello"},
+			"fr": {"title": "Bonjour"}
+		}
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"translations": {
+						"*": {
+							"$": "langs.&.code",
+							"$1": "langs.&1.source",
+							"title": "langs.&1.title"
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	langs, ok := output["langs"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected langs map, got %T", output["langs"])
+	}
+
+	for code, title := range map[string]string{"en": "Hello", "fr": "Bonjour"} {
+		lang, ok := langs[code].(map[string]interface{})
+		if !ok {
+			t.Errorf("Expected langs.%s map, got %v", code, langs[code])
+			continue
+		}
+		if lang["code"] != code {
+			t.Errorf("Expected langs.%s.code=%s, got %v", code, code, lang["code"])
+		}
+		if lang["source"] != "translations" {
+			t.Errorf("Expected langs.%s.source=translations, got %v", code, lang["source"])
+		}
+		if lang["title"] != title {
+			t.Errorf("Expected langs.%s.title=%s, got %v", code, title, lang["title"])
+		}
+	}
+}
+
+func TestShiftLiteralConstant(t *testing.T) {
+	input := `{
+		"line_items": [
+			{"sku": "A"},
+			{"sku": "B"}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"#v2": "meta.version",
+					"line_items": {
+						"*": {
+							"sku": "items[&1].sku",
+							"#shopify": "items[&1].source"
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	meta, ok := output["meta"].(map[string]interface{})
+	if !ok || meta["version"] != "v2" {
+		t.Errorf("Expected meta.version=v2, got %v", output["meta"])
+	}
+
+	items, ok := output["items"].([]interface{})
+	if !ok || len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %v", output["items"])
+	}
+	for i, item := range items {
+		m := item.(map[string]interface{})
+		if m["source"] != "shopify" {
+			t.Errorf("Expected items[%d].source=shopify, got %v", i, m["source"])
+		}
+		if m["sku"] == nil {
+			t.Errorf("Expected items[%d].sku to be set", i)
+		}
+	}
+}
+
+func TestShiftArrayAppend(t *testing.T) {
+	input := `{
+		"billing": {"email": "bill@example.com"},
+		"shipping": {"email": "ship@example.com"},
+		"translations": {"en": {}, "fr": {}},
+		"items": [
+			{"sku": "A", "qty": 1},
+			{"sku": "B", "qty": 2}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"billing": {"email": "emails[]"},
+					"shipping": {"email": "emails[]"},
+					"translations": {
+						"*": {"$": "codes[]"}
+					},
+					"items": {
+						"*": {
+							"sku": "lines[].code",
+							"qty": "lines[].quantity"
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	if got := fmt.Sprint(output["emails"]); got != "[bill@example.com ship@example.com]" {
+		t.Errorf("Expected both emails collected, got %s", got)
+	}
+	if got := fmt.Sprint(output["codes"]); got != "[en fr]" {
+		t.Errorf("Expected codes [en fr], got %s", got)
+	}
+
+	lines, ok := output["lines"].([]interface{})
+	if !ok || len(lines) != 2 {
+		t.Fatalf("Expected 2 grouped lines, got %v", output["lines"])
+	}
+	for i, want := range []struct {
+		code string
+		qty  float64
+	}{{"A", 1}, {"B", 2}} {
+		line := lines[i].(map[string]interface{})
+		if line["code"] != want.code || line["quantity"] != want.qty {
+			t.Errorf("Expected lines[%d]={code:%s quantity:%v}, got %v", i, want.code, want.qty, line)
+		}
+	}
+}
+
+func TestShiftArrayAppendPerElement(t *testing.T) {
+	input := `{
+		"tags": ["a", "b"],
+		"items": [
+			{"sku": "A", "tags": ["x", "y"]},
+			{"sku": "B", "tags": ["z"]}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"tags": {"*": "out[].tag"},
+					"items": {
+						"*": {
+							"tags": {"*": "itemTags[].tag"}
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	if got := fmt.Sprint(output["out"]); got != "[map[tag:a] map[tag:b]]" {
+		t.Errorf("Expected one element per scalar, got %s", got)
+	}
+	if got := fmt.Sprint(output["itemTags"]); got != "[map[tag:x] map[tag:y] map[tag:z]]" {
+		t.Errorf("Expected one element per nested tag, got %s", got)
+	}
+}
+
+func TestShiftPatternWildcards(t *testing.T) {
+	input := `{
+		"billing_street": "1 Main St",
+		"billing_city": "Springfield",
+		"shipping_street": "2 Side St",
+		"Order-Id": "o-1",
+		"Customer-Id": "c-1",
+		"note": "ignored",
+		"aXbYbZc": "multi"
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"*_*": "address.&(0,1).&(0,2)",
+					"*-Id": "ids.&(0,1)",
+					"a*b*c": "parts.&(0,1).&(0,2)"
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	address, ok := output["address"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected address map, got %T", output["address"])
+	}
+	billing, _ := address["billing"].(map[string]interface{})
+	if billing["street"] != "1 Main St" || billing["city"] != "Springfield" {
+		t.Errorf("Expected billing street and city, got %v", address["billing"])
+	}
+	shipping, _ := address["shipping"].(map[string]interface{})
+	if shipping["street"] != "2 Side St" {
+		t.Errorf("Expected shipping street, got %v", address["shipping"])
+	}
+
+	ids, _ := output["ids"].(map[string]interface{})
+	if ids["Order"] != "o-1" || ids["Customer"] != "c-1" {
+		t.Errorf("Expected ids Order and Customer, got %v", output["ids"])
+	}
+
+	parts, _ := output["parts"].(map[string]interface{})
+	x, _ := parts["X"].(map[string]interface{})
+	if x["YbZ"] != "multi" {
+		t.Errorf("Expected parts.X.YbZ=multi, got %v", output["parts"])
+	}
+
+	if _, exists := output["note"]; exists {
+		t.Errorf("Did not expect unmatched key note")
+	}
+}
+
+func TestShiftOrKeys(t *testing.T) {
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"contact": {
+						"email|mail|emailAddress": "email",
+						"phone|tel": "phones.&"
+					}
+				}
+			}
+		]
+	}`
+
+	for _, input := range []string{
+		`{"contact": {"email": "a@example.com", "tel": "555"}}`,
+		`{"contact": {"mail": "a@example.com", "tel": "555"}}`,
+		`{"contact": {"emailAddress": "a@example.com", "tel": "555"}}`,
+	} {
+		output := runTransform(t, input, specJSON)
+
+		if output["email"] != "a@example.com" {
+			t.Errorf("Expected email for input %s, got %v", input, output["email"])
+		}
+		phones, _ := output["phones"].(map[string]interface{})
+		if phones["tel"] != "555" {
+			t.Errorf("Expected & to resolve to the matched key tel, got %v", output["phones"])
+		}
+	}
+}
+
+func TestShiftValueMatching(t *testing.T) {
+	input := `{
+		"accounts": [
+			{"id": "a1", "type": "premium", "active": true},
+			{"id": "a2", "type": "basic", "active": false},
+			{"id": "a3", "type": "trial", "active": true},
+			{"id": "a4", "type": null, "active": true}
+		]
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"spec": {
+					"accounts": {
+						"*": {
+							"type": {
+								"premium": {"@(2,id)": "tiers.gold[]"},
+								"basic|free": {"@(2,id)": "tiers.standard[]"},
+								"null": {"@(2,id)": "tiers.unknown[]"},
+								"*": {"@(2,id)": "tiers.other[]"}
+							},
+							"active": {
+								"true": {"#yes": "status.&3"},
+								"false": {"#no": "status.&3"}
+							}
+						}
+					}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	tiers, ok := output["tiers"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected tiers map, got %T", output["tiers"])
+	}
+	for tier, want := range map[string]string{
+		"gold":     "[a1]",
+		"standard": "[a2]",
+		"other":    "[a3]",
+		"unknown":  "[a4]",
+	} {
+		if got := fmt.Sprint(tiers[tier]); got != want {
+			t.Errorf("Expected tiers.%s=%s, got %s", tier, want, got)
+		}
+	}
+
+	status, _ := output["status"].(map[string]interface{})
+	if status["0"] != "yes" || status["1"] != "no" {
+		t.Errorf("Expected status {0: yes, 1: no, ...}, got %v", output["status"])
+	}
+}
+
+func TestShiftPassthrough(t *testing.T) {
+	input := `{
+		"id": 7,
+		"customer": {"fname": "Ann", "lname": "Lee", "tier": "gold"},
+		"items": [{"cost": 5, "sku": "A"}, {"cost": 7, "sku": "B"}],
+		"notes": "keep me",
+		"status": "NEW"
+	}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"passthrough": true,
+				"spec": {
+					"customer": {
+						"fname": "customer.firstName",
+						"lname": "customer.lastName"
+					},
+					"items": {"*": {"cost": "items[&1].price"}},
+					"id": "status"
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	got := fmt.Sprint(output)
+	want := "map[customer:map[firstName:Ann lastName:Lee tier:gold] " +
+		"items:[map[price:5 sku:A] map[price:7 sku:B]] notes:keep me status:7]"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
+
+func TestShiftPassthroughMappedElement(t *testing.T) {
+	input := `{"items": [{"a": 1}, {"b": 2}], "tags": ["x", "y"]}`
+
+	specJSON := `{
+		"operations": [
+			{
+				"type": "shift",
+				"passthrough": true,
+				"spec": {
+					"items": {"0": {"a": "first"}},
+					"tags": {"1": "lastTag"}
+				}
+			}
+		]
+	}`
+
+	output := runTransform(t, input, specJSON)
+
+	got := fmt.Sprint(output)
+	want := "map[first:1 items:[map[b:2]] lastTag:y tags:[x]]"
+	if got != want {
+		t.Errorf("Expected %s, got %s", want, got)
+	}
+}
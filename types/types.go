@@ -7,9 +7,14 @@ type TransformSpec struct {
 
 // Operation is one step.
 type Operation struct {
-	// Type: "shift", "default"
+	// Type: "shift", "default", "remove", "sort", "cardinality",
+	// "modify-overwrite", "modify-default", "filter", "groupBy", "aggregate",
+	// "flatten", "unflatten", "merge", "rename", "coerce"
 	Type string `json:"type"`
 
 	// Spec config.
 	Spec interface{} `json:"spec"`
+
+	// Passthrough makes a shift copy input fields its spec never matched.
+	Passthrough bool `json:"passthrough,omitempty"`
 }